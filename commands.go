@@ -0,0 +1,215 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/sites"
+	"golang.org/x/term"
+)
+
+type command struct {
+	name        string
+	argsUsage   string
+	description string
+	minArgs     int
+	maxArgs     int  //-1 means no limit
+	report      bool //save a report of the run under the output root
+	run         func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{
+		name:        "sync",
+		description: "download all bookmarked artworks",
+		report:      true,
+		run: func(ctx context.Context, args []string) error {
+			return sites.DoPixiv(ctx)
+		},
+	},
+	{
+		name:        "novels",
+		description: "download all bookmarked novels",
+		report:      true,
+		run: func(ctx context.Context, args []string) error {
+			return sites.DoNovels(ctx)
+		},
+	},
+	{
+		name:        "download",
+		argsUsage:   "<artwork url or ID>...",
+		description: "download the given artworks",
+		minArgs:     1,
+		maxArgs:     -1,
+		report:      true,
+		run:         sites.DownloadArtworks,
+	},
+	{
+		name:        "user",
+		argsUsage:   "<user url or ID>...",
+		description: "download every work of the given users",
+		minArgs:     1,
+		maxArgs:     -1,
+		report:      true,
+		run:         sites.DownloadUserWorks,
+	},
+	{
+		name:        "following",
+		description: "download every work of every followed user",
+		report:      true,
+		run: func(ctx context.Context, args []string) error {
+			return sites.DownloadFollowing(ctx)
+		},
+	},
+	{
+		name:        "ranking",
+		argsUsage:   "[mode]...",
+		description: "download the top artworks of the rankings of the given modes, or of Rankings",
+		maxArgs:     -1,
+		report:      true,
+		run:         sites.DownloadRankings,
+	},
+	{
+		name:        "search",
+		argsUsage:   "[saved search name]...",
+		description: "download the results of the given saved searches, or of all of Searches",
+		maxArgs:     -1,
+		report:      true,
+		run:         sites.DownloadSearches,
+	},
+	{
+		name:        "retry-failed",
+		description: "process again the artworks and novels that failed in earlier runs",
+		report:      true,
+		run: func(ctx context.Context, args []string) error {
+			return sites.RetryFailed(ctx)
+		},
+	},
+	{
+		name:        "thumbnails",
+		description: "save the thumbnails of all bookmark pages",
+		run: func(ctx context.Context, args []string) error {
+			return sites.SaveBookmarkThumbnails(ctx)
+		},
+	},
+	{
+		name:        "verify",
+		description: "check saved files against the sizes and checksums in the manifest",
+		run: func(ctx context.Context, args []string) error {
+			return sites.VerifyFiles(ctx)
+		},
+	},
+	{
+		name:        "login",
+		description: "login and save the session for later runs",
+		run: func(ctx context.Context, args []string) error {
+			return sites.Login(ctx)
+		},
+	},
+	{
+		name:        "credentials",
+		description: "read the password from stdin and write it encrypted to CredentialsFile",
+		run: func(ctx context.Context, args []string) error {
+			password, err := readPassword(os.Stdin)
+			if err != nil {
+				return err
+			}
+			return sites.EncryptPassword(password)
+		},
+	},
+	{
+		name:        "logout",
+		description: "logout of the saved session and remove it",
+		run: func(ctx context.Context, args []string) error {
+			return sites.Logout(ctx)
+		},
+	},
+}
+
+// readPassword reads a line from r, without echoing it when r is a terminal
+func readPassword(r io.Reader) (password string, err error) {
+	fmt.Fprintf(os.Stderr, "password: ")
+	if f, ok := r.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		buf, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return password, fmt.Errorf("unable to read password: %+v", err)
+		}
+		password = string(buf)
+	} else {
+		line, err := bufio.NewReader(r).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return password, fmt.Errorf("unable to read password: %+v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return password, fmt.Errorf("empty password")
+	}
+	return password, nil
+}
+
+func getCommand(name string) (cmd command, ok bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return cmd, false
+}
+
+// parse parses the flags and checks the number of positional args of the command
+func (cmd command) parse(args []string) (cmdArgs []string, err error) {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [global flags] %s %s\n\n%s\n", programName, cmd.name, cmd.argsUsage, cmd.description)
+		fs.PrintDefaults()
+	}
+	err = fs.Parse(args)
+	if err != nil {
+		return cmdArgs, err
+	}
+	cmdArgs = fs.Args()
+	if len(cmdArgs) < cmd.minArgs || (cmd.maxArgs >= 0 && len(cmdArgs) > cmd.maxArgs) {
+		fs.Usage()
+		return cmdArgs, fmt.Errorf("wrong number of arguments for command \"%s\"", cmd.name)
+	}
+	return cmdArgs, nil
+}
+
+func printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "usage: %s [global flags] <command> [args]\n\ncommands:\n", programName)
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-12s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(out, "\nglobal flags:\n")
+	fs.PrintDefaults()
+	fmt.Fprintf(out, "\nexit codes: %d success, %d some artworks failed, %d fatal error\n", exitOK, exitPartial, exitFatal)
+}
@@ -23,24 +23,226 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/chromedp/chromedp"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
-	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/sites"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/report"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/shutdown"
+)
+
+const (
+	programName = `pixiv_bookmarks_downloader`
+
+	//exit codes
+	exitOK      = 0
+	exitPartial = 1 //the run finished but some artworks failed
+	exitFatal   = 2 //the run could not be done at all
 )
 
 func main() {
-	ctx, cancel := chromedp.NewExecAllocator(context.Background(), append(chromedp.DefaultExecAllocatorOptions[:], chromedp.Flag("headless", config.Config.Headless))...)
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet(programName, flag.ContinueOnError)
+	configPath := fs.String("config", "", "path of the config file (default $PIXIV_DOWNLOADER_CONF or config.yaml)")
+	config.RegisterFlags(fs)
+	fs.Usage = func() {
+		printUsage(fs)
+	}
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		return exitFatal
+	}
+
+	if fs.NArg() <= 0 {
+		printUsage(fs)
+		return exitFatal
+	}
+	cmd, ok := getCommand(fs.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command \"%s\"\n", fs.Arg(0))
+		printUsage(fs)
+		return exitFatal
+	}
+	cmdArgs, err := cmd.parse(fs.Args()[1:])
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %+v\n", config.ErrorMsgPrefix, err)
+		return exitFatal
+	}
+
+	err = loadConfig(fs, *configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %+v\n", config.ErrorMsgPrefix, err)
+		return exitFatal
+	}
+
+	var recorder *report.Recorder
+	if cmd.report {
+		recorder = report.NewRecorder(progress.Events, cmd.name, cmdArgs)
+	}
+	stopProgress := startProgress()
+	stop := shutdown.New()
+	handleSignals(stop)
+	ctx, cancel := newBrowserContext(context.Background())
 	defer cancel()
+	err = cmd.run(shutdown.NewContext(ctx, stop), cmdArgs)
+	stopProgress()
+	if recorder != nil {
+		saveReport(recorder.Finish(err))
+	}
+	return exitCodeOf(err)
+}
+
+func loadConfig(fs *flag.FlagSet, configPath string) (err error) {
+	err = config.Load(configPath, fs)
+	if err != nil {
+		return err
+	}
+	err = configureLogging()
+	if err != nil {
+		return err
+	}
+	schedule.Scheduler.Configure(config.Config.RequestInterval, config.Config.RequestJitter, config.Config.ThrottlePause)
+
+	for _, dir := range []string{config.SavedDir(), config.ThumbnailsDir()} {
+		err = os.MkdirAll(dir, config.DirPermission)
+		if err != nil {
+			return fmt.Errorf("unable to create output directory \"%s\": %+v", dir, err)
+		}
+	}
+	return nil
+}
+
+// configureLogging points the default logger at LogFile with LogLevel and LogFormat
+func configureLogging() (err error) {
+	level := logging.LevelInfo
+	if config.Config.LogLevel != "" {
+		level, err = logging.ParseLevel(config.Config.LogLevel)
+		if err != nil {
+			return fmt.Errorf("invalid LogLevel: %+v", err)
+		}
+	}
+	format := config.Config.LogFormat
+	switch format {
+	case "":
+		format = logging.FormatText
+	case logging.FormatText, logging.FormatJson:
+	default:
+		return fmt.Errorf("invalid LogFormat \"%s\", it should be %s or %s", format, logging.FormatText, logging.FormatJson)
+	}
+	var out io.Writer = os.Stderr
+	if config.Config.LogFile != "" {
+		//left open until the program exits
+		out, err = os.OpenFile(config.Config.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, config.WriteFilePermission)
+		if err != nil {
+			return fmt.Errorf("unable to open log file \"%s\": %+v", config.Config.LogFile, err)
+		}
+	}
+	logging.Default.Configure(out, level, format)
+	return nil
+}
+
+// startProgress keeps a progress line at the bottom of stderr when it is a terminal, unless HideProgress is set
+func startProgress() (stop func()) {
+	info, err := os.Stderr.Stat()
+	if config.Config.HideProgress || err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return func() {}
+	}
+	term := progress.NewTerminal(os.Stderr)
+	if config.Config.LogFile == "" {
+		logging.Default.SetOutput(term.Writer(os.Stderr))
+	}
+	term.Start(progress.Events)
+	return term.Stop
+}
+
+// handleSignals stops the run on the first SIGINT or SIGTERM, and cancels the artworks still in flight
+// ShutdownTimeout later. The browser is kept for logging out. A second signal exits at once.
+func handleSignals(stop *shutdown.Stop) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		timeout := config.Config.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = shutdown.DefaultTimeout
+		}
+		logging.Warn("stopping, no new artworks are started", "signal", sig.String(), "timeout", timeout.String())
+		stop.Stop()
+		select {
+		case <-time.After(timeout):
+			logging.Warn("cancelling the artworks still in flight")
+			stop.Abort()
+			sig = <-signals
+		case sig = <-signals:
+		}
+		logging.Error("exiting at once", "signal", sig.String())
+		os.Exit(exitFatal)
+	}()
+}
+
+// saveReport saves r under the reports directory and logs its totals. A report that cannot be saved does not fail the run.
+func saveReport(r report.Report) {
+	t := r.Totals
+	logging.Info("run finished", "downloaded", t.Downloaded, "alreadyPresent", t.AlreadyPresent,
+		"filtered", t.Filtered, "failed", t.Failed, "pages", t.Pages, "bytes", t.Bytes)
+	dir := config.ReportsDir()
+	err := os.MkdirAll(dir, config.DirPermission)
+	if err != nil {
+		logging.Error("unable to create reports directory", logging.KeyPath, dir, logging.KeyError, err)
+		return
+	}
+	path, err := r.Save(dir)
+	if err != nil {
+		logging.Error("unable to save run report", logging.KeyPath, path, logging.KeyError, err)
+		return
+	}
+	logging.Info("saved run report", logging.KeyPath, path)
+}
+
+func newBrowserContext(parent context.Context) (ctx context.Context, cancel func()) {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.Flag("headless", config.Config.Headless))
+	opts = append(opts, browserProcessOptions()...)
+	ctx, cancelAllocator := chromedp.NewExecAllocator(parent, opts...)
 	// create chrome instance
-	ctx, cancel = chromedp.NewContext(
+	ctx, cancelBrowser := chromedp.NewContext(
 		ctx,
 		// chromedp.WithDebugf(log.Printf),
 	)
-	defer cancel()
+	schedule.WatchResponses(ctx)
+	return ctx, func() {
+		cancelBrowser()
+		cancelAllocator()
+	}
+}
 
-	// create a timeout
-	// ctx, cancel = context.WithTimeout(ctx, 180*time.Second)
-	// defer cancel()
-	sites.DoPixiv(ctx)
+func exitCodeOf(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	logging.Error("run failed", logging.KeyError, err)
+	var partialErr *common.PartialError
+	if errors.As(err, &partialErr) {
+		return exitPartial
+	}
+	return exitFatal
 }
@@ -0,0 +1,127 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	DefaultBookmarkPageSize = 48
+
+	//which bookmark list to get
+	RestShow = `show` //the public bookmarks
+	RestHide = `hide` //the private bookmarks
+)
+
+// Bookmark is an artwork in the bookmark listing
+type Bookmark struct {
+	ID         ID       `json:"id"`
+	Title      string   `json:"title"`
+	IllustType int      `json:"illustType"`
+	UserID     ID       `json:"userId"`
+	UserName   string   `json:"userName"`
+	Tags       []string `json:"tags"`
+	PageCount  int      `json:"pageCount"`
+	IsMasked   bool     `json:"isMasked"` //deleted or private works
+}
+
+// BookmarkQuery picks the bookmarks to list
+type BookmarkQuery struct {
+	Rest string //RestShow or RestHide
+	Tag  string //only the bookmarks carrying this bookmark tag of the user. All bookmarks when empty
+}
+
+type bookmarksBody struct {
+	Works []Bookmark `json:"works"`
+	Total int        `json:"total"`
+}
+
+// Bookmarks gets a single page of the illustration bookmarks of a user picked by q
+func (c *Client) Bookmarks(ctx context.Context, userID string, q BookmarkQuery, offset, limit int) (bookmarks []Bookmark, total int, err error) {
+	query := url.Values{}
+	query.Set("tag", q.Tag)
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("rest", q.Rest)
+
+	var body bookmarksBody
+	err = c.getJson(ctx, fmt.Sprintf("/ajax/user/%s/illusts/bookmarks", userID), query, &body)
+	if err != nil {
+		return bookmarks, total, fmt.Errorf("failed to get bookmarks at offset %d: %w", offset, err)
+	}
+	return body.Works, body.Total, nil
+}
+
+// EnumerateBookmarks pages through all bookmarks of a user picked by q and calls handle on every page,
+// until there are no more bookmarks or handle asks to stop.
+// maxPages <= 0 means no limit.
+func (c *Client) EnumerateBookmarks(ctx context.Context, userID string, q BookmarkQuery, pageSize, maxPages int,
+	handle func(page []Bookmark, position PagePosition) (stop bool, err error)) (err error) {
+	return enumeratePages(pageSize, maxPages, func(offset, limit int, position func(total int) PagePosition) (count, total int, stop bool, err error) {
+		bookmarks, total, err := c.Bookmarks(ctx, userID, q, offset, limit)
+		if err != nil || len(bookmarks) <= 0 {
+			return 0, total, false, err
+		}
+		stop, err = handle(bookmarks, position(total))
+		return len(bookmarks), total, stop, err
+	})
+}
+
+// PagePosition is where a page is in an enumeration
+type PagePosition struct {
+	Number int //from 1
+	Pages  int //how many pages will be enumerated, as far as the total of the page tells
+}
+
+// enumeratePages calls getPage with the offset and the position of every page until a page is empty, the total is reached,
+// maxPages pages were got or getPage asks to stop. count is the number of items on the page.
+func enumeratePages(pageSize, maxPages int,
+	getPage func(offset, limit int, position func(total int) PagePosition) (count, total int, stop bool, err error)) (err error) {
+	if pageSize <= 0 {
+		pageSize = DefaultBookmarkPageSize
+	}
+	for offset, ithPage := 0, 1; maxPages <= 0 || ithPage <= maxPages; offset, ithPage = offset+pageSize, ithPage+1 {
+		number := ithPage
+		position := func(total int) PagePosition {
+			pages := (total + pageSize - 1) / pageSize
+			if maxPages > 0 && pages > maxPages {
+				pages = maxPages
+			}
+			if pages < number {
+				pages = number
+			}
+			return PagePosition{Number: number, Pages: pages}
+		}
+		count, total, stop, err := getPage(offset, pageSize, position)
+		if err != nil {
+			return err
+		}
+		if count <= 0 || stop || offset+count >= total {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+var cannedBookmarkPages = map[string]string{
+	"0": `{"error":false,"message":"","body":{"total":3,"works":[
+		{"id":"100","title":"first","illustType":0,"userId":"7","userName":"alice","tags":["a","b"],"pageCount":2},
+		{"id":"101","title":"second","illustType":2,"userId":"8","userName":"bob","tags":[],"pageCount":1}]}}`,
+	"2": `{"error":false,"message":"","body":{"total":3,"works":[
+		{"id":102,"title":"-----","illustType":0,"userId":0,"userName":"","tags":[],"pageCount":1,"isMasked":true}]}}`,
+}
+
+var cannedPrivateBookmarkPages = map[string]string{
+	"0": `{"error":false,"message":"","body":{"total":1,"works":[
+		{"id":"200","title":"hidden","illustType":0,"userId":"9","userName":"carol","tags":["c"],"pageCount":1}]}}`,
+}
+
+var cannedTaggedBookmarkPages = map[string]string{
+	"0": `{"error":false,"message":"","body":{"total":1,"works":[
+		{"id":"101","title":"second","illustType":2,"userId":"8","userName":"bob","tags":[],"pageCount":1}]}}`,
+}
+
+func newBookmarkServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ajax/user/42/illusts/bookmarks" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("limit") != "2" {
+			t.Errorf("unexpected limit %q", r.URL.Query().Get("limit"))
+		}
+		pages := cannedBookmarkPages
+		switch rest := r.URL.Query().Get("rest"); rest {
+		case RestShow:
+		case RestHide:
+			pages = cannedPrivateBookmarkPages
+		default:
+			t.Errorf("unexpected rest %q", rest)
+		}
+		switch tag := r.URL.Query().Get("tag"); tag {
+		case "":
+		case "wallpaper":
+			pages = cannedTaggedBookmarkPages
+		default:
+			t.Errorf("unexpected tag %q", tag)
+		}
+		page, ok := pages[r.URL.Query().Get("offset")]
+		if !ok {
+			fmt.Fprint(w, `{"error":true,"message":"bad offset","body":[]}`)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+}
+
+func TestEnumerateBookmarks(t *testing.T) {
+	server := newBookmarkServer(t)
+	defer server.Close()
+	client := &Client{BaseUrl: server.URL, Fetch: NewHttpFetch(server.Client(), nil)}
+
+	var got []Bookmark
+	var positions []PagePosition
+	err := client.EnumerateBookmarks(context.Background(), "42", BookmarkQuery{Rest: RestShow}, 2, 0, func(page []Bookmark, position PagePosition) (bool, error) {
+		got = append(got, page...)
+		positions = append(positions, position)
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("EnumerateBookmarks() error = %+v", err)
+	}
+	wantPositions := []PagePosition{{Number: 1, Pages: 2}, {Number: 2, Pages: 2}}
+	if !reflect.DeepEqual(positions, wantPositions) {
+		t.Errorf("EnumerateBookmarks() positions %+v, want %+v", positions, wantPositions)
+	}
+
+	want := []Bookmark{
+		{ID: "100", Title: "first", UserID: "7", UserName: "alice", Tags: []string{"a", "b"}, PageCount: 2},
+		{ID: "101", Title: "second", IllustType: 2, UserID: "8", UserName: "bob", Tags: []string{}, PageCount: 1},
+		{ID: "102", Title: "-----", UserID: "0", Tags: []string{}, PageCount: 1, IsMasked: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EnumerateBookmarks() got %+v, want %+v", got, want)
+	}
+}
+
+func TestEnumerateBookmarksPrivate(t *testing.T) {
+	server := newBookmarkServer(t)
+	defer server.Close()
+	client := &Client{BaseUrl: server.URL, Fetch: NewHttpFetch(server.Client(), nil)}
+
+	var got []Bookmark
+	err := client.EnumerateBookmarks(context.Background(), "42", BookmarkQuery{Rest: RestHide}, 2, 0, func(page []Bookmark, position PagePosition) (bool, error) {
+		got = append(got, page...)
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("EnumerateBookmarks() error = %+v", err)
+	}
+
+	want := []Bookmark{
+		{ID: "200", Title: "hidden", UserID: "9", UserName: "carol", Tags: []string{"c"}, PageCount: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EnumerateBookmarks() got %+v, want %+v", got, want)
+	}
+}
+
+func TestEnumerateBookmarksTag(t *testing.T) {
+	server := newBookmarkServer(t)
+	defer server.Close()
+	client := &Client{BaseUrl: server.URL, Fetch: NewHttpFetch(server.Client(), nil)}
+
+	var got []Bookmark
+	err := client.EnumerateBookmarks(context.Background(), "42", BookmarkQuery{Rest: RestShow, Tag: "wallpaper"}, 2, 0, func(page []Bookmark, position PagePosition) (bool, error) {
+		got = append(got, page...)
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("EnumerateBookmarks() error = %+v", err)
+	}
+
+	want := []Bookmark{
+		{ID: "101", Title: "second", IllustType: 2, UserID: "8", UserName: "bob", Tags: []string{}, PageCount: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EnumerateBookmarks() got %+v, want %+v", got, want)
+	}
+}
+
+func TestEnumerateBookmarksStop(t *testing.T) {
+	server := newBookmarkServer(t)
+	defer server.Close()
+	client := &Client{BaseUrl: server.URL, Fetch: NewHttpFetch(server.Client(), nil)}
+
+	pages := 0
+	err := client.EnumerateBookmarks(context.Background(), "42", BookmarkQuery{Rest: RestShow}, 2, 0, func(page []Bookmark, position PagePosition) (bool, error) {
+		pages++
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("EnumerateBookmarks() error = %+v", err)
+	}
+	if pages != 1 {
+		t.Errorf("EnumerateBookmarks() handled %d pages after stop, want 1", pages)
+	}
+}
+
+func TestEnumerateBookmarksErrors(t *testing.T) {
+	server := newBookmarkServer(t)
+	defer server.Close()
+	client := &Client{BaseUrl: server.URL, Fetch: NewHttpFetch(server.Client(), nil)}
+	handle := func(page []Bookmark, position PagePosition) (bool, error) { return false, nil }
+
+	err := client.EnumerateBookmarks(context.Background(), "43", BookmarkQuery{Rest: RestShow}, 2, 0, handle)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("EnumerateBookmarks() of unknown user error = %+v, want a 404 status error", err)
+	}
+
+	err = client.EnumerateBookmarks(context.Background(), "42", BookmarkQuery{Rest: RestShow}, 2, 0, func(page []Bookmark, position PagePosition) (bool, error) {
+		return false, fmt.Errorf("boom")
+	})
+	if err == nil {
+		t.Errorf("EnumerateBookmarks() did not return the error of handle")
+	}
+}
@@ -0,0 +1,138 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FetchFunc does a GET request to rawUrl and returns the response body
+type FetchFunc func(ctx context.Context, rawUrl string) (body []byte, err error)
+
+// StatusError is returned by a FetchFunc when the server answers with a non 2xx status
+type StatusError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET \"%s\" returned status %d", e.Url, e.StatusCode)
+}
+
+// Temporary tells if the request may succeed later, which is the case when rate limited or when the server failed
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// Client calls pixiv's ajax endpoints through Fetch
+type Client struct {
+	BaseUrl string
+	Fetch   FetchFunc
+}
+
+type response struct {
+	Error   bool            `json:"error"`
+	Message string          `json:"message"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// ID is an artwork or user ID. pixiv sends it either as a string or as a number.
+type ID string
+
+func (id *ID) UnmarshalJSON(buf []byte) error {
+	var str string
+	if err := json.Unmarshal(buf, &str); err == nil {
+		*id = ID(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(buf, &num); err != nil {
+		return fmt.Errorf("invalid ID %s: %+v", string(buf), err)
+	}
+	*id = ID(num.String())
+	return nil
+}
+
+func (c *Client) getJson(ctx context.Context, path string, query url.Values, body interface{}) (err error) {
+	var resp response
+	rawUrl, err := c.getPlainJson(ctx, path, query, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Error {
+		return fmt.Errorf("\"%s\" returned error: %s", rawUrl, resp.Message)
+	}
+	err = json.Unmarshal(resp.Body, body)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal body of \"%s\": %+v", rawUrl, err)
+	}
+	return nil
+}
+
+// getPlainJson is for the endpoints that do not wrap their json in an error and a body
+func (c *Client) getPlainJson(ctx context.Context, path string, query url.Values, v interface{}) (rawUrl string, err error) {
+	rawUrl = strings.TrimSuffix(c.BaseUrl, "/") + path
+	if len(query) > 0 {
+		rawUrl += "?" + query.Encode()
+	}
+	buf, err := c.Fetch(ctx, rawUrl)
+	if err != nil {
+		return rawUrl, err
+	}
+	err = json.Unmarshal(buf, v)
+	if err != nil {
+		return rawUrl, fmt.Errorf("unable to unmarshal response of \"%s\": %+v", rawUrl, err)
+	}
+	return rawUrl, nil
+}
+
+// NewHttpFetch makes a FetchFunc out of a plain http client
+func NewHttpFetch(client *http.Client, header http.Header) FetchFunc {
+	return func(ctx context.Context, rawUrl string) (body []byte, err error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+		if err != nil {
+			return body, fmt.Errorf("unable to create request for \"%s\": %+v", rawUrl, err)
+		}
+		for key, vals := range header {
+			req.Header[key] = vals
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return body, fmt.Errorf("failed to GET \"%s\": %+v", rawUrl, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return body, &StatusError{Url: rawUrl, StatusCode: resp.StatusCode}
+		}
+		body, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return body, fmt.Errorf("failed to read body of \"%s\": %+v", rawUrl, err)
+		}
+		return body, nil
+	}
+}
@@ -0,0 +1,153 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	IllustTypeIllust = 0
+	IllustTypeManga  = 1
+	IllustTypeUgoira = 2
+)
+
+const (
+	XRestrictR18  = 1
+	XRestrictR18G = 2
+	AiTypeAi      = 2
+)
+
+// Tag is a tag of an artwork. Translation is keyed by language, e.g. "en".
+type Tag struct {
+	Tag         string            `json:"tag"`
+	Translation map[string]string `json:"translation,omitempty"`
+}
+
+type illustTags struct {
+	Tags []Tag `json:"tags"`
+}
+
+// BookmarkData tells if an artwork is bookmarked by the logged in user
+type BookmarkData struct {
+	ID      ID   `json:"id"`
+	Private bool `json:"private"`
+}
+
+// Illust is the detail of an artwork
+type Illust struct {
+	ID           ID            `json:"illustId"`
+	Title        string        `json:"illustTitle"`
+	Comment      string        `json:"illustComment"`
+	IllustType   int           `json:"illustType"`
+	UserID       ID            `json:"userId"`
+	UserName     string        `json:"userName"`
+	Tags         illustTags    `json:"tags"`
+	CreateDate   string        `json:"createDate"`
+	UploadDate   string        `json:"uploadDate"`
+	PageCount    int           `json:"pageCount"`
+	XRestrict    int           `json:"xRestrict"`
+	AiType       int           `json:"aiType"`
+	BookmarkData *BookmarkData `json:"bookmarkData"`
+	//how many users bookmarked it
+	BookmarkCount int `json:"bookmarkCount"`
+}
+
+// PageUrls are the image urls of a page in every size
+type PageUrls struct {
+	ThumbMini string `json:"thumb_mini"`
+	Small     string `json:"small"`
+	Regular   string `json:"regular"`
+	Original  string `json:"original"`
+}
+
+// IllustPage is a page of an artwork
+type IllustPage struct {
+	Urls   PageUrls `json:"urls"`
+	Width  int      `json:"width"`
+	Height int      `json:"height"`
+}
+
+// BookmarkDetail is what the logged in user attached to a bookmark
+type BookmarkDetail struct {
+	ID         ID       `json:"id"`
+	Private    bool     `json:"private"`
+	Tags       []string `json:"tags,omitempty"`
+	Comment    string   `json:"comment,omitempty"`
+	CreateDate string   `json:"createDate,omitempty"`
+}
+
+type bookmarkDetailBody struct {
+	BookmarkData *BookmarkDetail `json:"bookmarkData"`
+}
+
+// UgoiraFrame is a single frame of an animated illustration. Delay is in milliseconds.
+type UgoiraFrame struct {
+	File  string `json:"file"`
+	Delay int    `json:"delay"`
+}
+
+// UgoiraMeta tells where the frames of an animated illustration are and how long each of them is shown
+type UgoiraMeta struct {
+	Src         string        `json:"src"`
+	OriginalSrc string        `json:"originalSrc"`
+	MimeType    string        `json:"mime_type"`
+	Frames      []UgoiraFrame `json:"frames"`
+}
+
+// Illust gets the detail of an artwork
+func (c *Client) Illust(ctx context.Context, artworkID string) (illust Illust, err error) {
+	err = c.getJson(ctx, fmt.Sprintf("/ajax/illust/%s", artworkID), nil, &illust)
+	if err != nil {
+		return illust, fmt.Errorf("failed to get detail of artwork %s: %w", artworkID, err)
+	}
+	return illust, nil
+}
+
+// IllustPages gets the image urls of every page of an artwork
+func (c *Client) IllustPages(ctx context.Context, artworkID string) (pages []IllustPage, err error) {
+	err = c.getJson(ctx, fmt.Sprintf("/ajax/illust/%s/pages", artworkID), nil, &pages)
+	if err != nil {
+		return pages, fmt.Errorf("failed to get pages of artwork %s: %w", artworkID, err)
+	}
+	return pages, nil
+}
+
+// UgoiraMeta gets the frame metadata of an animated illustration
+func (c *Client) UgoiraMeta(ctx context.Context, artworkID string) (meta UgoiraMeta, err error) {
+	err = c.getJson(ctx, fmt.Sprintf("/ajax/illust/%s/ugoira_meta", artworkID), nil, &meta)
+	if err != nil {
+		return meta, fmt.Errorf("failed to get ugoira meta of artwork %s: %w", artworkID, err)
+	}
+	return meta, nil
+}
+
+// BookmarkDetail gets the bookmark of the logged in user on an artwork. detail is nil when the artwork is not bookmarked.
+func (c *Client) BookmarkDetail(ctx context.Context, artworkID string) (detail *BookmarkDetail, err error) {
+	var body bookmarkDetailBody
+	err = c.getJson(ctx, fmt.Sprintf("/ajax/illust/%s/bookmarkData", artworkID), nil, &body)
+	if err != nil {
+		return detail, fmt.Errorf("failed to get bookmark of artwork %s: %w", artworkID, err)
+	}
+	return body.BookmarkData, nil
+}
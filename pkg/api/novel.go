@@ -0,0 +1,113 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// NovelBookmark is a novel in the bookmark listing
+type NovelBookmark struct {
+	ID          ID       `json:"id"`
+	Title       string   `json:"title"`
+	UserID      ID       `json:"userId"`
+	UserName    string   `json:"userName"`
+	Tags        []string `json:"tags"`
+	TextCount   int      `json:"textCount"`
+	SeriesID    ID       `json:"seriesId"`
+	SeriesTitle string   `json:"seriesTitle"`
+	IsMasked    bool     `json:"isMasked"` //deleted or private works
+}
+
+type novelBookmarksBody struct {
+	Works []NovelBookmark `json:"works"`
+	Total int             `json:"total"`
+}
+
+// NovelSeriesNav tells which series a novel is a chapter of
+type NovelSeriesNav struct {
+	SeriesID ID     `json:"seriesId"`
+	Title    string `json:"title"`
+	Order    int    `json:"order"` //the chapter number, from 1
+}
+
+// Novel is the detail of a novel. Content is the text in pixiv's novel markup.
+type Novel struct {
+	ID             ID              `json:"id"`
+	Title          string          `json:"title"`
+	Description    string          `json:"description"` //html
+	Content        string          `json:"content"`
+	CoverUrl       string          `json:"coverUrl"`
+	UserID         ID              `json:"userId"`
+	UserName       string          `json:"userName"`
+	Tags           illustTags      `json:"tags"`
+	CreateDate     string          `json:"createDate"`
+	UploadDate     string          `json:"uploadDate"`
+	Language       string          `json:"language"`
+	CharacterCount int             `json:"characterCount"`
+	XRestrict      int             `json:"xRestrict"`
+	AiType         int             `json:"aiType"`
+	SeriesNavData  *NovelSeriesNav `json:"seriesNavData"`
+	BookmarkData   *BookmarkData   `json:"bookmarkData"`
+}
+
+// NovelBookmarks gets a single page of the novel bookmarks of a user picked by q
+func (c *Client) NovelBookmarks(ctx context.Context, userID string, q BookmarkQuery, offset, limit int) (bookmarks []NovelBookmark, total int, err error) {
+	query := url.Values{}
+	query.Set("tag", q.Tag)
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("rest", q.Rest)
+
+	var body novelBookmarksBody
+	err = c.getJson(ctx, fmt.Sprintf("/ajax/user/%s/novels/bookmarks", userID), query, &body)
+	if err != nil {
+		return bookmarks, total, fmt.Errorf("failed to get novel bookmarks at offset %d: %w", offset, err)
+	}
+	return body.Works, body.Total, nil
+}
+
+// EnumerateNovelBookmarks pages through the novel bookmarks of a user like EnumerateBookmarks does
+func (c *Client) EnumerateNovelBookmarks(ctx context.Context, userID string, q BookmarkQuery, pageSize, maxPages int,
+	handle func(page []NovelBookmark, position PagePosition) (stop bool, err error)) (err error) {
+	return enumeratePages(pageSize, maxPages, func(offset, limit int, position func(total int) PagePosition) (count, total int, stop bool, err error) {
+		bookmarks, total, err := c.NovelBookmarks(ctx, userID, q, offset, limit)
+		if err != nil || len(bookmarks) <= 0 {
+			return 0, total, false, err
+		}
+		stop, err = handle(bookmarks, position(total))
+		return len(bookmarks), total, stop, err
+	})
+}
+
+// Novel gets the detail and the text of a novel
+func (c *Client) Novel(ctx context.Context, novelID string) (novel Novel, err error) {
+	err = c.getJson(ctx, fmt.Sprintf("/ajax/novel/%s", novelID), nil, &novel)
+	if err != nil {
+		return novel, fmt.Errorf("failed to get novel %s: %w", novelID, err)
+	}
+	return novel, nil
+}
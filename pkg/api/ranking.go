@@ -0,0 +1,77 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	RankingPageSize = 50
+)
+
+// RankingItem is an artwork in a ranking
+type RankingItem struct {
+	ID       ID     `json:"illust_id"`
+	Title    string `json:"title"`
+	UserID   ID     `json:"user_id"`
+	UserName string `json:"user_name"`
+	Rank     int    `json:"rank"`
+}
+
+type rankingBody struct {
+	Contents []RankingItem `json:"contents"`
+	Next     interface{}   `json:"next"` //the next page, false on the last page
+	Total    int           `json:"rank_total"`
+	Error    string        `json:"error"`
+}
+
+// Ranking gets a single page of a ranking, from page 1. mode is e.g. "daily", "weekly" or "monthly".
+// content narrows it down to "illust", "manga" or "ugoira" and is everything when empty.
+// date is YYYYMMDD and the latest ranking when empty.
+func (c *Client) Ranking(ctx context.Context, mode, content, date string, page int) (items []RankingItem, hasNext bool, err error) {
+	query := url.Values{}
+	query.Set("mode", mode)
+	if content != "" {
+		query.Set("content", content)
+	}
+	if date != "" {
+		query.Set("date", date)
+	}
+	query.Set("p", strconv.Itoa(page))
+	query.Set("format", "json")
+
+	var body rankingBody
+	rawUrl, err := c.getPlainJson(ctx, "/ranking.php", query, &body)
+	if err != nil {
+		return items, hasNext, fmt.Errorf("failed to get page %d of %s ranking: %w", page, mode, err)
+	}
+	if body.Error != "" {
+		return items, hasNext, fmt.Errorf("\"%s\" returned error: %s", rawUrl, body.Error)
+	}
+	next, ok := body.Next.(float64)
+	return body.Contents, ok && next > 0, nil
+}
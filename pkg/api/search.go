@@ -0,0 +1,105 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	SearchPageSize = 60
+
+	//what a search matches the word against
+	SearchMatchTag     = `s_tag_full` //a whole tag
+	SearchMatchPartial = `s_tag`      //part of a tag
+	SearchMatchText    = `s_tc`       //the title or the caption
+
+	//the order of search results. Popularity is only for premium accounts.
+	SearchOrderNewest  = `date_d`
+	SearchOrderOldest  = `date`
+	SearchOrderPopular = `popular_d`
+)
+
+// SearchQuery is a keyword search of artworks with its filters. Empty fields are not sent.
+type SearchQuery struct {
+	Word         string
+	Type         string //all, illust_and_ugoira, illust, manga or ugoira
+	Match        string //one of the SearchMatch values
+	Mode         string //all, safe or r18
+	Order        string //one of the SearchOrder values
+	From         string //the earliest upload date, YYYY-MM-DD
+	To           string //the latest upload date, YYYY-MM-DD
+	MinBookmarks int    //only honored by pixiv for premium accounts
+}
+
+// SearchResult is an artwork in the search results
+type SearchResult struct {
+	ID         ID     `json:"id"`
+	Title      string `json:"title"`
+	IllustType int    `json:"illustType"`
+	UserID     ID     `json:"userId"`
+	UserName   string `json:"userName"`
+	IsMasked   bool   `json:"isMasked"`
+}
+
+type searchResults struct {
+	Data  []SearchResult `json:"data"`
+	Total int            `json:"total"`
+}
+
+type searchBody struct {
+	IllustManga searchResults `json:"illustManga"`
+}
+
+// Search gets a single page of the results of q, from page 1
+func (c *Client) Search(ctx context.Context, q SearchQuery, page int) (results []SearchResult, total int, err error) {
+	query := url.Values{}
+	query.Set("word", q.Word)
+	query.Set("p", strconv.Itoa(page))
+	optional := map[string]string{
+		"type":   q.Type,
+		"s_mode": q.Match,
+		"mode":   q.Mode,
+		"order":  q.Order,
+		"scd":    q.From,
+		"ecd":    q.To,
+	}
+	for key, val := range optional {
+		if val != "" {
+			query.Set(key, val)
+		}
+	}
+	if q.MinBookmarks > 0 {
+		query.Set("blt", strconv.Itoa(q.MinBookmarks))
+	}
+
+	var body searchBody
+	err = c.getJson(ctx, "/ajax/search/artworks/"+url.PathEscape(q.Word), query, &body)
+	if err != nil {
+		return results, total, fmt.Errorf("failed to get page %d of search results of \"%s\": %w", page, q.Word, err)
+	}
+	return body.IllustManga.Data, body.IllustManga.Total, nil
+}
@@ -0,0 +1,125 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	DefaultFollowingPageSize = 24
+)
+
+// FollowedUser is a user in the following listing
+type FollowedUser struct {
+	UserID   ID     `json:"userId"`
+	UserName string `json:"userName"`
+}
+
+type followingBody struct {
+	Users []FollowedUser `json:"users"`
+	Total int            `json:"total"`
+}
+
+// idSet is a set of work IDs. pixiv sends an object keyed by ID, or an empty array when there are none.
+type idSet map[string]struct{}
+
+func (s *idSet) UnmarshalJSON(buf []byte) error {
+	var ids map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &ids); err != nil {
+		var empty []json.RawMessage
+		if json.Unmarshal(buf, &empty) == nil && len(empty) <= 0 {
+			*s = idSet{}
+			return nil
+		}
+		return fmt.Errorf("invalid work IDs %s: %+v", string(buf), err)
+	}
+	*s = make(idSet, len(ids))
+	for id := range ids {
+		(*s)[id] = struct{}{}
+	}
+	return nil
+}
+
+type profileAllBody struct {
+	Illusts idSet `json:"illusts"`
+	Manga   idSet `json:"manga"`
+}
+
+// UserWorks gets the IDs of every illustration and manga of a user, newest first
+func (c *Client) UserWorks(ctx context.Context, userID string) (artworkIDs []string, err error) {
+	var body profileAllBody
+	err = c.getJson(ctx, fmt.Sprintf("/ajax/user/%s/profile/all", userID), nil, &body)
+	if err != nil {
+		return artworkIDs, fmt.Errorf("failed to get works of user %s: %w", userID, err)
+	}
+	for _, set := range []idSet{body.Illusts, body.Manga} {
+		for id := range set {
+			artworkIDs = append(artworkIDs, id)
+		}
+	}
+	//IDs grow with time
+	sort.Slice(artworkIDs, func(i, j int) bool {
+		a, _ := strconv.ParseInt(artworkIDs[i], 10, 64)
+		b, _ := strconv.ParseInt(artworkIDs[j], 10, 64)
+		return a > b
+	})
+	return artworkIDs, nil
+}
+
+// Following gets a single page of the users a user follows. rest is RestShow or RestHide.
+func (c *Client) Following(ctx context.Context, userID string, rest string, offset, limit int) (users []FollowedUser, total int, err error) {
+	query := url.Values{}
+	query.Set("tag", "")
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("rest", rest)
+
+	var body followingBody
+	err = c.getJson(ctx, fmt.Sprintf("/ajax/user/%s/following", userID), query, &body)
+	if err != nil {
+		return users, total, fmt.Errorf("failed to get followed users at offset %d: %w", offset, err)
+	}
+	return body.Users, body.Total, nil
+}
+
+// EnumerateFollowing pages through the users a user follows like EnumerateBookmarks does
+func (c *Client) EnumerateFollowing(ctx context.Context, userID string, rest string, pageSize, maxPages int,
+	handle func(page []FollowedUser, position PagePosition) (stop bool, err error)) (err error) {
+	if pageSize <= 0 {
+		pageSize = DefaultFollowingPageSize
+	}
+	return enumeratePages(pageSize, maxPages, func(offset, limit int, position func(total int) PagePosition) (count, total int, stop bool, err error) {
+		users, total, err := c.Following(ctx, userID, rest, offset, limit)
+		if err != nil || len(users) <= 0 {
+			return 0, total, false, err
+		}
+		stop, err = handle(users, position(total))
+		return len(users), total, stop, err
+	})
+}
@@ -78,3 +78,24 @@ func ConcatenateErrors(errors ...error) error {
 
 	return fmt.Errorf(strings.Join(errorSlice, "\n -"))
 }
+
+// PartialError is an error after which the run carried on, e.g. some artworks failed to download
+type PartialError struct {
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// Partial marks err as a PartialError
+func Partial(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PartialError{Err: err}
+}
@@ -0,0 +1,223 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
+)
+
+var (
+	imageMagics = [][]byte{
+		{0xFF, 0xD8, 0xFF},          //jpeg
+		[]byte("\x89PNG\r\n\x1a\n"), //png
+		[]byte("GIF87a"),            //gif
+		[]byte("GIF89a"),            //gif
+	}
+	zipMagic = []byte("PK\x03\x04")
+)
+
+// Checksum is the hex sha256 of buf
+func Checksum(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// ChecksumFile is the size and hex sha256 of the file at filePath
+func ChecksumFile(filePath string) (size int64, sum string, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return size, sum, fmt.Errorf("unable to open \"%s\": %+v", filePath, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err = io.Copy(h, f)
+	if err != nil {
+		return size, sum, fmt.Errorf("failed to read \"%s\": %+v", filePath, err)
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyImage checks that buf is a whole image and not e.g. an html error page.
+// mimeType is the content type the server claimed, it is not checked when empty.
+func VerifyImage(buf []byte, mimeType string) (err error) {
+	err = verifyImageHeader(buf, mimeType)
+	if err != nil {
+		return err
+	}
+	//decoding the whole image catches truncated files
+	_, _, err = image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("unable to decode image: %+v", err)
+	}
+	return nil
+}
+
+// verifyImageHeader checks the content type and the magic bytes at the start of an image
+func verifyImageHeader(head []byte, mimeType string) (err error) {
+	if mimeType != "" && !strings.HasPrefix(mimeType, "image/") {
+		return fmt.Errorf("content type is \"%s\", not an image", mimeType)
+	}
+	if detected := http.DetectContentType(head); !strings.HasPrefix(detected, "image/") {
+		return fmt.Errorf("content looks like \"%s\", not an image", detected)
+	}
+	hasMagic := false
+	for _, magic := range imageMagics {
+		if bytes.HasPrefix(head, magic) {
+			hasMagic = true
+			break
+		}
+	}
+	if !hasMagic {
+		return fmt.Errorf("content does not start with the magic bytes of jpeg, png or gif")
+	}
+	return nil
+}
+
+// VerifyZip checks that buf starts like a zip file
+func VerifyZip(buf []byte) (err error) {
+	if !bytes.HasPrefix(buf, zipMagic) {
+		return fmt.Errorf("content does not start with the magic bytes of zip")
+	}
+	return nil
+}
+
+// VerifyFile checks buf by the extension of filePath
+func VerifyFile(filePath string, buf []byte, mimeType string) (err error) {
+	if strings.EqualFold(filepath.Ext(filePath), ".zip") {
+		return VerifyZip(buf)
+	}
+	return VerifyImage(buf, mimeType)
+}
+
+// VerifySavedFile checks the file saved at savedPath, e.g. a part file, like VerifyFile does for filePath,
+// without reading it all into memory
+func VerifySavedFile(savedPath string, filePath string, mimeType string) (err error) {
+	f, err := os.Open(savedPath)
+	if err != nil {
+		return fmt.Errorf("unable to open \"%s\": %+v", savedPath, err)
+	}
+	defer f.Close()
+	head := make([]byte, 512) //all http.DetectContentType looks at
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("failed to read \"%s\": %+v", savedPath, err)
+	}
+	head = head[:n]
+	if strings.EqualFold(filepath.Ext(filePath), ".zip") {
+		return VerifyZip(head)
+	}
+	err = verifyImageHeader(head, mimeType)
+	if err != nil {
+		return err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek \"%s\": %+v", savedPath, err)
+	}
+	_, _, err = image.Decode(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("unable to decode image: %+v", err)
+	}
+	return nil
+}
+
+// SaveVerifiedFile verifies buf, writes it to filePath atomically and records it in the manifest
+func SaveVerifiedFile(filePath string, buf []byte, mimeType string) (err error) {
+	err = VerifyFile(filePath, buf, mimeType)
+	if err != nil {
+		return fmt.Errorf("refusing to write \"%s\": %+v", filePath, err)
+	}
+	return SaveFile(filePath, buf)
+}
+
+// SaveFile writes buf to filePath atomically and records it in the manifest
+func SaveFile(filePath string, buf []byte) (err error) {
+	err = WriteFileAtomic(filePath, buf)
+	if err != nil {
+		return err
+	}
+	progress.Emit(progress.Event{Kind: progress.BytesWritten, Path: filePath, Bytes: int64(len(buf))})
+	return state.Manifest.Add(filePath, int64(len(buf)), Checksum(buf))
+}
+
+// CreateTempFile creates the temp file that is later renamed to filePath by CommitTempFile
+func CreateTempFile(filePath string) (f *os.File, err error) {
+	f, err = ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.part")
+	if err != nil {
+		return f, fmt.Errorf("unable to create temp file for \"%s\": %+v", filePath, err)
+	}
+	return f, nil
+}
+
+// CommitTempFile flushes and closes f and renames it to filePath. f is removed on failure.
+func CommitTempFile(f *os.File, filePath string) (err error) {
+	err = f.Sync()
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), config.WriteFilePermission)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filePath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to move temp file to \"%s\": %+v", filePath, err)
+	}
+	return nil
+}
+
+// WriteFileAtomic writes buf to a temp file next to filePath and renames it into place,
+// so that a crash never leaves a truncated file at filePath
+func WriteFileAtomic(filePath string, buf []byte) (err error) {
+	f, err := CreateTempFile(filePath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, bytes.NewReader(buf))
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write temp file for \"%s\": %+v", filePath, err)
+	}
+	return CommitTempFile(f, filePath)
+}
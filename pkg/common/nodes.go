@@ -24,12 +24,11 @@ package common
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
-	"path"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/chromedp"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
 )
 
 //TargetNode is used to target a specific node which chromedp does QueryAction on.
@@ -68,7 +67,7 @@ func PrintNodesAltAndSrc(nodes []*cdp.Node) {
 	nodeMap := GetNodesAttrsMap(nodes)
 	nodeCount := 1
 	for node, attrMap := range nodeMap {
-		fmt.Printf("node #%d: nodeType=\"%s\" alt=\"%s\", src=\"%s\"\n", nodeCount, node.NodeType, attrMap[config.AltAttrName], attrMap[config.SrcAttrName])
+		logging.Debug("node", "number", nodeCount, "nodeType", node.NodeType.String(), "alt", attrMap[config.AltAttrName], "src", attrMap[config.SrcAttrName])
 		nodeCount++
 	}
 }
@@ -83,7 +82,6 @@ func saveScreenshotsOfNodes(ctx context.Context, nodes []*cdp.Node,
 		if filenamePrefix == "" {
 			continue
 		}
-		filename := path.Base(src)
 		var buf []byte
 		errInner := chromedp.Run(ctx,
 			chromedp.Screenshot(config.AnySel, &buf, TargetNode(imgNode)),
@@ -92,7 +90,7 @@ func saveScreenshotsOfNodes(ctx context.Context, nodes []*cdp.Node,
 			errs = append(errs, fmt.Errorf("failed to take screenshot of node: %+v", errInner))
 			continue
 		}
-		errInner = howToSave(buf, filename)
+		errInner = howToSave(buf, src)
 		if errInner != nil {
 			errs = append(errs, errInner)
 		}
@@ -101,14 +99,16 @@ func saveScreenshotsOfNodes(ctx context.Context, nodes []*cdp.Node,
 }
 
 func SaveScreenshotsOfThumbnailNodes(ctx context.Context, imgNodes []*cdp.Node) (err error) {
-	howToSave := func(buf []byte, filename string) error {
-		filepath := fmt.Sprintf("%s/%s", config.ThumbnailsFileLocation, filename)
-		err = ioutil.WriteFile(filepath, buf, config.WriteFilePermission)
+	howToSave := func(buf []byte, src string) error {
+		filePath, err := GetThumbnailPath(src)
 		if err != nil {
-			fmt.Printf("%s %+v\n", config.ErrorMsgPrefix, err)
-			return fmt.Errorf("failed to write to file \"%s\": %+v", filepath, err)
+			return err
 		}
-		fmt.Printf("%s wrote %s\n", config.InfMsgPrefix, filepath)
+		err = SaveVerifiedFile(filePath, buf, "image/png")
+		if err != nil {
+			return fmt.Errorf("failed to write to file \"%s\": %+v", filePath, err)
+		}
+		logging.FromContext(ctx).Info("wrote file", logging.KeyPath, filePath)
 		return nil
 	}
 	return saveScreenshotsOfNodes(ctx, imgNodes, howToSave)
@@ -0,0 +1,69 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package common
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/paths"
+)
+
+// GetThumbnailPath is where the thumbnail at url is saved
+func GetThumbnailPath(url string) (filePath string, err error) {
+	artworkID := Get1stGroupMatch(url, config.ArtworkIDRe)
+	if artworkID == "" {
+		return filePath, fmt.Errorf("no artwork ID in thumbnail url \"%s\"", url)
+	}
+	filename := path.Base(url)
+	values := paths.Values{
+		paths.VarArtworkID: artworkID,
+		paths.VarFilename:  filename,
+		paths.VarExt:       strings.TrimPrefix(path.Ext(filename), "."),
+	}
+	return config.ThumbnailPath(values)
+}
+
+// GetArtworkPagePath is where the full res image at url is saved.
+// artworkValues are the values of the artwork the image belongs to, e.g. the title and the artist.
+func GetArtworkPagePath(artworkValues paths.Values, url string) (filePath string, err error) {
+	matches := config.ArtworkImgRe.FindStringSubmatch(url)
+	if len(matches) < config.ArtworkImgRe.NumSubexp()+1 {
+		return filePath, fmt.Errorf("url \"%s\" is not a full res image", url)
+	}
+	page, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return filePath, fmt.Errorf("invalid page \"%s\" in url \"%s\"", matches[2], url)
+	}
+	values := paths.Values{}
+	for k, v := range artworkValues {
+		values[k] = v
+	}
+	values[paths.VarArtworkID] = matches[1]
+	values[paths.VarPage] = page
+	values[paths.VarExt] = matches[3]
+	values[paths.VarFilename] = path.Base(url)
+	return config.SavedPath(values)
+}
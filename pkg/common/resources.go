@@ -24,40 +24,33 @@ package common
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/cdproto/network"
-	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
-	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
 )
 
-func StartSavingResponseToFile(ctx context.Context, requestID network.RequestID, filepath string) (err error) {
+// StartSavingResponseToFile saves the body of a finished response. mimeType is the content type of the response.
+func StartSavingResponseToFile(ctx context.Context, requestID network.RequestID, filepath string, mimeType string) (err error) {
 	param := network.GetResponseBody(requestID)
 	if param == nil {
 		return
 	}
 	c := chromedp.FromContext(ctx)
-	buf, err := param.Do(cdp.WithExecutor(ctx, c.Target))
+	var buf []byte
+	err = Retry(ctx, "getting the response body of "+filepath, func() (err error) {
+		buf, err = param.Do(cdp.WithExecutor(ctx, c.Target))
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error when doing param.Do(ctx): %+v", err)
 	}
-	fmt.Printf("writing to file \"%s\"\n", filepath)
-	if err = ioutil.WriteFile(filepath, buf, config.WriteFilePermission); err != nil {
+	logger := logging.FromContext(ctx).With(logging.KeyRequest, string(requestID), logging.KeyPath, filepath)
+	logger.Debug("writing response body")
+	if err = SaveVerifiedFile(filepath, buf, mimeType); err != nil {
 		return fmt.Errorf("error: failed to write to %s: %+v", filepath, err)
 	}
-	fmt.Printf("wrote %s\n", filepath)
+	logger.Info("wrote file")
 	return nil
 }
-
-func LogPageLoaded(ctx context.Context) {
-	c := chromedp.FromContext(ctx)
-	chromedp.ListenTarget(ctx, func(ev interface{}) {
-		switch ev := ev.(type) {
-		case *page.EventLoadEventFired:
-			fmt.Printf("EventLoadEventFired for target ID \"%s\" at %s\n", c.Target.TargetID, ev.Timestamp.Time().String())
-			// other needed network Event
-		}
-	})
-}
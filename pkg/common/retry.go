@@ -0,0 +1,143 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+)
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = 30 * time.Second
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsRetryable tells if a failed step may succeed when tried again.
+// Errors that have a Temporary method, like api.StatusError, are retried only when it returns true.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) {
+		return temporary.Temporary()
+	}
+	return true
+}
+
+// Retry runs do until it succeeds, fails with an error that is not retryable, runs out of attempts or ctx is done.
+// what describes the step in the log when it gives up.
+func Retry(ctx context.Context, what string, do func() error) (err error) {
+	attempts, _, _ := retrySettings()
+	for attempt := 1; ; attempt++ {
+		err = do()
+		if err == nil {
+			return nil
+		}
+		if !IsRetryable(err) {
+			return err
+		}
+		if attempt >= attempts {
+			break
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		delay := backoffDelay(attempt)
+		logging.FromContext(ctx).Warn(what+" failed, retrying", "attempt", attempt, "attempts", attempts, "delay", delay, logging.KeyError, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+	logging.FromContext(ctx).Error("giving up on "+what, "attempts", attempts, logging.KeyError, err)
+	//wrapped so that callers can still tell e.g. an api.StatusError with errors.As
+	return fmt.Errorf("%s failed after %d attempts: %w", what, attempts, err)
+}
+
+// backoffDelay doubles the base delay for every attempt up to the max delay,
+// and picks a random delay between half of it and all of it so that tabs do not retry in lockstep
+func backoffDelay(attempt int) time.Duration {
+	_, base, maxDelay := retrySettings()
+	delay := base
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// retrySettings falls back to the defaults for unset fields, or when no config is loaded
+func retrySettings() (attempts int, base time.Duration, maxDelay time.Duration) {
+	attempts, base, maxDelay = defaultRetryAttempts, defaultRetryBaseDelay, defaultRetryMaxDelay
+	if config.Config == nil {
+		return attempts, base, maxDelay
+	}
+	if config.Config.RetryAttempts > 0 {
+		attempts = config.Config.RetryAttempts
+	}
+	if config.Config.RetryBaseDelay > 0 {
+		base = config.Config.RetryBaseDelay
+	}
+	if config.Config.RetryMaxDelay > 0 {
+		maxDelay = config.Config.RetryMaxDelay
+	}
+	return attempts, base, maxDelay
+}
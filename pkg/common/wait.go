@@ -0,0 +1,181 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+)
+
+const (
+	pollInterval = 100 * time.Millisecond
+	//pages keep a couple of long lived requests open, so the network counts as idle with this many in flight
+	idleMaxInFlight = 2
+)
+
+// The ListenFor functions start listening right away, so that events fired by the
+// actions run before the returned wait action are not missed. Every wait fails once
+// timeout has passed since it started waiting, and stops listening when it returns.
+// The wait does not run when an action before it fails, so callers defer stop as well.
+
+// ListenForLoadEvent returns an action waiting for the next load event of the tab of ctx
+func ListenForLoadEvent(ctx context.Context, timeout time.Duration) (wait chromedp.Action, stop func()) {
+	lctx, cancel := context.WithCancel(ctx)
+	fired := make(chan struct{}, 1)
+	c := chromedp.FromContext(ctx)
+	chromedp.ListenTarget(lctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *page.EventLoadEventFired:
+			logging.FromContext(ctx).Debug("page loaded", logging.KeyTab, c.Target.TargetID.String(), "at", ev.Timestamp.Time())
+			select {
+			case fired <- struct{}{}:
+			default:
+			}
+		}
+	})
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		defer cancel()
+		return waitForSignal(ctx, fired, timeout, "the load event")
+	}), cancel
+}
+
+// ListenForImageResponse returns an action waiting for the response of an image whose url matches
+func ListenForImageResponse(ctx context.Context, match func(url string) bool, timeout time.Duration) (wait chromedp.Action, stop func()) {
+	lctx, cancel := context.WithCancel(ctx)
+	received := make(chan struct{}, 1)
+	chromedp.ListenTarget(lctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *network.EventResponseReceived:
+			if ev.Type == network.ResourceTypeImage && match(ev.Response.URL) {
+				select {
+				case received <- struct{}{}:
+				default:
+				}
+			}
+		}
+	})
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		defer cancel()
+		return waitForSignal(ctx, received, timeout, "the image response")
+	}), cancel
+}
+
+// ListenForNetworkIdle returns an action waiting until the requests of the tab of ctx have settled for idle
+func ListenForNetworkIdle(ctx context.Context, idle time.Duration, timeout time.Duration) (wait chromedp.Action, stop func()) {
+	lctx, cancel := context.WithCancel(ctx)
+	var lock sync.Mutex
+	inFlight := make(map[network.RequestID]bool)
+	lastActivity := time.Now()
+	chromedp.ListenTarget(lctx, func(ev interface{}) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch ev := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			inFlight[ev.RequestID] = true
+		case *network.EventLoadingFinished:
+			delete(inFlight, ev.RequestID)
+		case *network.EventLoadingFailed:
+			delete(inFlight, ev.RequestID)
+		default:
+			return
+		}
+		lastActivity = time.Now()
+	})
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		defer cancel()
+		return poll(ctx, timeout, "the network to be idle", func() (bool, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			return len(inFlight) <= idleMaxInFlight && time.Since(lastActivity) >= idle, nil
+		})
+	}), cancel
+}
+
+// WaitElementCountStable waits until the number of elements matching the css selector sel
+// has not changed for stableFor, e.g. for lazily loaded thumbnails after scrolling
+func WaitElementCountStable(sel string, stableFor time.Duration, timeout time.Duration) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		quotedSel, err := json.Marshal(sel)
+		if err != nil {
+			return fmt.Errorf("unable to quote selector \"%s\": %+v", sel, err)
+		}
+		count := -1
+		changedAt := time.Now()
+		return poll(ctx, timeout, fmt.Sprintf("the number of \"%s\" to be stable", sel), func() (bool, error) {
+			var current int
+			err := chromedp.Evaluate(fmt.Sprintf(`document.querySelectorAll(%s).length`, quotedSel), &current).Do(ctx)
+			if err != nil {
+				return false, err
+			}
+			if current != count {
+				count = current
+				changedAt = time.Now()
+				return false, nil
+			}
+			return time.Since(changedAt) >= stableFor, nil
+		})
+	})
+}
+
+func waitForSignal(ctx context.Context, signal <-chan struct{}, timeout time.Duration, what string) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-signal:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("timed out after %s waiting for %s", timeout, what)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func poll(ctx context.Context, timeout time.Duration, what string, done func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		ok, err := done()
+		if err != nil {
+			return fmt.Errorf("failed while waiting for %s: %+v", what, err)
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s", timeout, what)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -22,28 +22,98 @@
 package config
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/paths"
 	"gopkg.in/yaml.v2"
 )
 
 var (
 	Config *configFile
+
+	savedPathTemplate     paths.Template
+	thumbnailPathTemplate paths.Template
+	novelPathTemplate     paths.Template
 )
 
 const (
-	configFileEnvName     = `PIXIV_DOWNLOADER_CONF`
-	defaultConfigFilePath = `config.yaml`
+	configFileEnvName      = `PIXIV_DOWNLOADER_CONF`
+	defaultConfigFilePath  = `config.yaml`
+	DefaultSessionFilePath = `session.json`
+	DefaultStateFilePath   = `state.json`
+	ManifestFileName       = `manifest.jsonl`
+	FailuresFileName       = `failures.json`
+
+	DefaultSavedPathTemplate     = `{artwork_id}_p{page}.{ext}`
+	DefaultThumbnailPathTemplate = `{filename}`
+	DefaultNovelPathTemplate     = `{artwork_id}.{ext}`
+
+	//a 0 pace is valid, so the pacing durations are negative until they are set
+	UnsetDuration time.Duration = -1
+
+	//the passphrase of the credentials file is never read from the config file
+	CredentialsPassphraseEnvName = `PIXIV_DOWNLOADER_CREDENTIALS_PASSPHRASE`
 )
 
 type configFile struct {
 	Headless                 bool   `yaml:"Headless"`
 	Username                 string `yaml:"Username"`
-	Password                 string `yaml:"Password"`
+	Password                 string `yaml:"Password" flag:"-"` //no flag nor environment variable, see PasswordFile and PasswordEnv
 	UserID                   string `yaml:"UserID"`
 	MaxBookmarkPageIteration int    `yaml:"MaxBookmarkPageIteration"`
+	BookmarkVisibility       string `yaml:"BookmarkVisibility"`       //which bookmark lists to go through: public, private or both. public when unset
+	SessionFile              string `yaml:"SessionFile"`              //where the session cookies are kept between runs
+	LogoutAfterRun           bool   `yaml:"LogoutAfterRun"`           //log out and remove the saved session at the end of every run
+	StateFile                string `yaml:"StateFile"`                //where the record of downloaded artworks is kept
+	Incremental              bool   `yaml:"Incremental"`              //skip downloaded artworks and stop at the first fully downloaded page
+	UgoiraFrameFolder        bool   `yaml:"UgoiraFrameFolder"`        //also extract ugoira frames with an ffmpeg concat file
+	OutputRoot               string `yaml:"OutputRoot" flag:"output"` //the directory saved artworks and thumbnails go to
+	SavedPathTemplate        string `yaml:"SavedPathTemplate"`        //where a page of an artwork is saved under the saved directory
+	ThumbnailPathTemplate    string `yaml:"ThumbnailPathTemplate"`    //where a thumbnail is saved under the thumbnails directory
+	//filtering bookmarks by the bookmark tags of the user
+	BookmarkTags        []string `yaml:"BookmarkTags"`        //only download the bookmarks carrying one of these bookmark tags. All bookmarks when unset
+	ExcludeBookmarkTags []string `yaml:"ExcludeBookmarkTags"` //skip the bookmarks carrying any of these bookmark tags
+	//archiving bookmarked novels
+	NovelPathTemplate string `yaml:"NovelPathTemplate"` //where the files of a novel are saved under the novels directory, they only differ by {ext}
+	NovelFormat       string `yaml:"NovelFormat"`       //md or txt, md when unset
+	NovelEpub         bool   `yaml:"NovelEpub"`         //also build an EPUB of every novel
+	//rankings and saved searches, only set in the config file
+	Rankings []Ranking `yaml:"Rankings"` //what the ranking command goes through when no mode is given
+	Searches []Search  `yaml:"Searches"` //what the search command goes through
+	//processing artworks in parallel
+	Tabs        int `yaml:"Tabs"`        //how many tabs process artworks at the same time, 3 when unset
+	MaxInFlight int `yaml:"MaxInFlight"` //how many artworks may be queued or in progress at once, twice Tabs when unset
+	//downloading originals
+	MaxDownloads   int  `yaml:"MaxDownloads"`   //how many files are downloaded at the same time, 4 when unset
+	BrowserCapture bool `yaml:"BrowserCapture"` //save originals from the responses the browser gets instead of downloading them directly
+	//pacing requests to pixiv
+	RequestInterval    time.Duration `yaml:"RequestInterval"`    //the least time between two browser steps across all tabs, 2s when unset, 0 for none
+	RequestJitter      time.Duration `yaml:"RequestJitter"`      //the most random time added to RequestInterval, 1s when unset, 0 for none
+	ThrottlePause      time.Duration `yaml:"ThrottlePause"`      //how long to pause when pixiv answers with 429 or 403, 1m when unset
+	RateLimitPageTexts []string      `yaml:"RateLimitPageTexts"` //texts that only show on pixiv's rate limit page
+	//retrying failed browser steps and downloads
+	RetryAttempts  int           `yaml:"RetryAttempts"`  //how many times a step is tried, 3 when unset
+	RetryBaseDelay time.Duration `yaml:"RetryBaseDelay"` //the delay before the first retry, doubled for every retry after, 1s when unset
+	RetryMaxDelay  time.Duration `yaml:"RetryMaxDelay"`  //the longest delay between retries, 30s when unset
+	//logging
+	LogLevel  string `yaml:"LogLevel"`  //debug, info, warn or error, info when unset
+	LogFormat string `yaml:"LogFormat"` //text or json, text when unset
+	LogFile   string `yaml:"LogFile"`   //where the log lines are appended, stderr when unset
+	//showing the progress
+	HideProgress bool `yaml:"HideProgress"` //do not keep a progress line at the bottom of the terminal
+	//stopping on ctrl-c or SIGTERM
+	ShutdownTimeout time.Duration `yaml:"ShutdownTimeout"` //how long the artworks in flight may take to finish before they are cancelled, 30s when unset
+	//other places to get the password from when Password is empty, tried in this order
+	PasswordFile              string `yaml:"PasswordFile"`              //a file holding the password
+	PasswordEnv               string `yaml:"PasswordEnv"`               //the name of an environment variable holding the password
+	PasswordCommand           string `yaml:"PasswordCommand"`           //a shell command printing the password
+	CredentialsFile           string `yaml:"CredentialsFile"`           //a file written by the credentials command
+	CredentialsPassphraseFile string `yaml:"CredentialsPassphraseFile"` //a file holding the passphrase of CredentialsFile
 	//some text for helping locate html nodes
 	UsernameInputPH            string `yaml:"UsernameInputPlaceHolder"`
 	PasswordInputPH            string `yaml:"PasswordInputPlaceHolder"`
@@ -54,27 +124,135 @@ type configFile struct {
 	BookmarkTutorialBannerText string `yaml:"BookmarkTutorialBannerText"`
 }
 
-func init() {
-	path := os.Getenv(configFileEnvName)
+// Load builds the config. Each source overrides the one before it:
+//  1. the config file at path, or at $PIXIV_DOWNLOADER_CONF, or config.yaml
+//  2. the PIXIV_DOWNLOADER_* environment variables
+//  3. the flags in fs that were given on the command line
+//
+// A missing config file is fine as long as the environment or the flags set something.
+func Load(path string, fs *flag.FlagSet) (err error) {
+	if path == "" {
+		path = os.Getenv(configFileEnvName)
+	}
 	if path == "" {
 		path = defaultConfigFilePath
 	}
-	c, err := readConfigFile(path)
+
+	c := configFile{RequestInterval: UnsetDuration, RequestJitter: UnsetDuration}
+	_, statErr := os.Stat(path)
+	fileMissing := os.IsNotExist(statErr)
+	if !fileMissing {
+		err = readConfigFile(path, &c)
+		if err != nil {
+			return err
+		}
+	}
+
+	envCount, err := applyEnv(&c)
 	if err != nil {
-		panic(err.Error())
+		return err
+	}
+	flagCount, err := applyFlags(&c, fs)
+	if err != nil {
+		return err
+	}
+	if fileMissing && envCount+flagCount <= 0 {
+		return fmt.Errorf("no config file at \"%s\" and no %s* environment variable or flag is set", path, envPrefix)
 	}
+
+	err = parsePathTemplates(&c)
+	if err != nil {
+		return err
+	}
+
 	Config = &c
+	return nil
+}
+
+func parsePathTemplates(c *configFile) (err error) {
+	if c.SavedPathTemplate == "" {
+		c.SavedPathTemplate = DefaultSavedPathTemplate
+	}
+	if c.ThumbnailPathTemplate == "" {
+		c.ThumbnailPathTemplate = DefaultThumbnailPathTemplate
+	}
+	savedPathTemplate, err = paths.Parse(c.SavedPathTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid SavedPathTemplate: %+v", err)
+	}
+	thumbnailPathTemplate, err = paths.Parse(c.ThumbnailPathTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid ThumbnailPathTemplate: %+v", err)
+	}
+	if c.NovelPathTemplate == "" {
+		c.NovelPathTemplate = DefaultNovelPathTemplate
+	}
+	novelPathTemplate, err = paths.Parse(c.NovelPathTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid NovelPathTemplate: %+v", err)
+	}
+	//the text, the cover, the metadata and the epub of a novel would overwrite each other
+	if !novelPathTemplate.Uses(paths.VarExt) {
+		return fmt.Errorf("invalid NovelPathTemplate \"%s\": it has to use {%s}", c.NovelPathTemplate, paths.VarExt)
+	}
+	return nil
+}
+
+// SavedPath is where a page of an artwork is saved. Its directory is created if missing.
+func SavedPath(values paths.Values) (path string, err error) {
+	return savedPathTemplate.Create(SavedDir(), values)
+}
+
+// ThumbnailPath is where a thumbnail is saved. Its directory is created if missing.
+func ThumbnailPath(values paths.Values) (path string, err error) {
+	return thumbnailPathTemplate.Create(ThumbnailsDir(), values)
+}
+
+// NovelPath is where a file of a novel is saved. Its directory is created if missing.
+func NovelPath(values paths.Values) (path string, err error) {
+	return novelPathTemplate.Create(NovelsDir(), values)
+}
+
+// ManifestPath is where the checksums of saved files are recorded
+func ManifestPath() string {
+	return filepath.Join(Config.OutputRoot, ManifestFileName)
+}
+
+// FailuresPath is where the failed artworks and novels wait for the retry-failed command
+func FailuresPath() string {
+	return filepath.Join(Config.OutputRoot, FailuresFileName)
+}
+
+// SavedDir is where full res artworks are saved
+func SavedDir() string {
+	return filepath.Join(Config.OutputRoot, SavedFileLocation)
+}
+
+// ThumbnailsDir is where thumbnails of bookmarks are saved
+func ThumbnailsDir() string {
+	return filepath.Join(Config.OutputRoot, ThumbnailsFileLocation)
+}
+
+// NovelsDir is where bookmarked novels are saved
+func NovelsDir() string {
+	return filepath.Join(Config.OutputRoot, NovelsFileLocation)
+}
+
+// ReportsDir is where the reports of runs are saved
+func ReportsDir() string {
+	return filepath.Join(Config.OutputRoot, ReportsFileLocation)
 }
 
-func readConfigFile(path string) (c configFile, err error) {
+// readConfigFile reads the config file at path into c, keeping the fields of c that the file does not set
+func readConfigFile(path string, c *configFile) (err error) {
 	f, err := ioutil.ReadFile(path)
 	if err != nil {
-		return c, fmt.Errorf("unable to read file at \"%s\": %+v", path, err)
+		return fmt.Errorf("unable to read file at \"%s\": %+v", path, err)
 	}
-	err = yaml.Unmarshal(f, &c)
+	err = yaml.Unmarshal(f, c)
 	if err != nil {
-		return c, fmt.Errorf("unable to unmarshal yaml file at \"%s\": %+v", path, err)
+		return fmt.Errorf("unable to unmarshal yaml file at \"%s\": %+v", path, err)
 	}
 
-	return c, nil
+	return nil
 }
@@ -0,0 +1,66 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package config
+
+const (
+	DefaultMaxItems = 100
+)
+
+// Ranking is a ranking to download the top artworks of
+type Ranking struct {
+	Mode     string `yaml:"Mode"`     //daily, weekly, monthly, rookie, original, male, female, or one of the _r18 ones
+	Content  string `yaml:"Content"`  //all, illust, manga or ugoira. all when unset
+	Date     string `yaml:"Date"`     //the day of the ranking as YYYYMMDD, the latest when unset
+	MaxItems int    `yaml:"MaxItems"` //how many of the top artworks to go through, 100 when unset
+}
+
+// Search is a saved search to download the results of
+type Search struct {
+	Name         string `yaml:"Name"`         //what the search is called on the command line
+	Word         string `yaml:"Word"`         //the keyword or tag
+	Type         string `yaml:"Type"`         //all, illust (with ugoira), manga or ugoira. all when unset
+	Match        string `yaml:"Match"`        //tag (a whole tag), partial (part of a tag) or text (title and caption). tag when unset
+	Mode         string `yaml:"Mode"`         //all, safe or r18. all when unset
+	Order        string `yaml:"Order"`        //newest, oldest or popular (premium only). newest when unset
+	From         string `yaml:"From"`         //the earliest upload date as YYYY-MM-DD
+	To           string `yaml:"To"`           //the latest upload date as YYYY-MM-DD
+	MinBookmarks int    `yaml:"MinBookmarks"` //skip artworks with fewer bookmarks
+	MaxItems     int    `yaml:"MaxItems"`     //how many results to go through, 100 when unset
+}
+
+// GetMaxItems is MaxItems or its default
+func (r Ranking) GetMaxItems() int {
+	return getMaxItems(r.MaxItems)
+}
+
+// GetMaxItems is MaxItems or its default
+func (s Search) GetMaxItems() int {
+	return getMaxItems(s.MaxItems)
+}
+
+func getMaxItems(maxItems int) int {
+	if maxItems <= 0 {
+		return DefaultMaxItems
+	}
+	return maxItems
+}
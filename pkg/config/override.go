@@ -0,0 +1,204 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	envPrefix = `PIXIV_DOWNLOADER_`
+	yamlTag   = `yaml`
+	flagTag   = `flag` //overrides the flag name derived from the yaml name, "-" leaves out both the flag and the environment variable
+)
+
+type configField struct {
+	index    int
+	yamlName string
+	flagName string
+	envName  string
+	kind     reflect.Kind
+}
+
+// fieldFlag keeps the raw value of a flag until it is applied on top of the config file
+type fieldFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *fieldFlag) String() string {
+	return f.value
+}
+
+func (f *fieldFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// splitWords splits a CamelCase name into its words, keeping acronyms such as "ID" together
+func splitWords(name string) (words []string) {
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+		nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if unicode.IsUpper(runes[i]) && (prevLower || nextLower) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+func getConfigFields() (fields []configField) {
+	t := reflect.TypeOf(configFile{})
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		yamlName := strings.Split(structField.Tag.Get(yamlTag), ",")[0]
+		if yamlName == "" || yamlName == "-" {
+			continue
+		}
+		//lists of objects have no flat form for an environment variable or a flag
+		if structField.Type.Kind() == reflect.Slice && structField.Type.Elem().Kind() == reflect.Struct {
+			continue
+		}
+		//secrets would show up in ps and the shell history
+		if structField.Tag.Get(flagTag) == "-" {
+			continue
+		}
+		words := splitWords(yamlName)
+		field := configField{
+			index:    i,
+			yamlName: yamlName,
+			flagName: strings.ToLower(strings.Join(words, "-")),
+			envName:  envPrefix + strings.ToUpper(strings.Join(words, "_")),
+			kind:     structField.Type.Kind(),
+		}
+		if name := structField.Tag.Get(flagTag); name != "" {
+			field.flagName = name
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// RegisterFlags adds a flag for every field of the config file to fs
+func RegisterFlags(fs *flag.FlagSet) {
+	for _, field := range getConfigFields() {
+		//a backquoted name is shown as the value placeholder of the flag, which bool flags don't have
+		usage := fmt.Sprintf("overrides `%s` of the config file and $%s", field.yamlName, field.envName)
+		if field.kind == reflect.Bool {
+			usage = fmt.Sprintf("overrides %s of the config file and $%s", field.yamlName, field.envName)
+		}
+		fs.Var(&fieldFlag{isBool: field.kind == reflect.Bool}, field.flagName, usage)
+	}
+}
+
+func setField(c *configFile, field configField, raw string) (err error) {
+	v := reflect.ValueOf(c).Elem().Field(field.index)
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case field.kind == reflect.String:
+		v.SetString(raw)
+	case field.kind == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case field.kind == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case field.kind == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type().String())
+	}
+	return nil
+}
+
+// applyEnv overrides fields with the PIXIV_DOWNLOADER_* environment variables that are set
+func applyEnv(c *configFile) (count int, err error) {
+	for _, field := range getConfigFields() {
+		raw, ok := os.LookupEnv(field.envName)
+		if !ok {
+			continue
+		}
+		err = setField(c, field, raw)
+		if err != nil {
+			return count, fmt.Errorf("invalid value \"%s\" of $%s: %+v", raw, field.envName, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// applyFlags overrides fields with the flags that were given on the command line
+func applyFlags(c *configFile, fs *flag.FlagSet) (count int, err error) {
+	if fs == nil {
+		return 0, nil
+	}
+	fieldsByFlag := make(map[string]configField)
+	for _, field := range getConfigFields() {
+		fieldsByFlag[field.flagName] = field
+	}
+	fs.Visit(func(f *flag.Flag) {
+		field, ok := fieldsByFlag[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		raw := f.Value.String()
+		err = setField(c, field, raw)
+		if err != nil {
+			err = fmt.Errorf("invalid value \"%s\" of -%s: %+v", raw, f.Name, err)
+			return
+		}
+		count++
+	})
+	return count, err
+}
@@ -23,15 +23,21 @@ package config
 
 import (
 	"regexp"
-	"runtime"
 	"time"
-
-	"github.com/chromedp/cdproto/input"
 )
 
 const (
 	//some urls
-	PixivSiteUrl = `https://www.pixiv.net`
+	PixivSiteUrl      = `https://www.pixiv.net`
+	ArtworkUrlFormat  = PixivSiteUrl + `/artworks/%s`
+	BookmarkUrlFormat = PixivSiteUrl + `/users/%s/bookmarks/artworks?rest=%s`
+	PixivReferer      = PixivSiteUrl + `/`
+	//the bookmarks carrying a bookmark tag, the tag is path escaped
+	TaggedBookmarkUrlFormat = PixivSiteUrl + `/users/%s/bookmarks/artworks/%s?rest=%s`
+	//novels and where they link to
+	NovelUrlFormat       = PixivSiteUrl + `/novel/show.php?id=%s`
+	NovelSeriesUrlFormat = PixivSiteUrl + `/novel/series/%s`
+	UserUrlFormat        = PixivSiteUrl + `/users/%s`
 
 	//some selectors
 	AnySel             = `*`
@@ -45,6 +51,7 @@ const (
 	SvgNodeSel         = `svg`
 	NavvNodeSel        = `nav`
 	DivNodeSel         = `div`
+	BookmarkItemImgSel = `a[href*="/artworks/"] > div > img`
 
 	//some attribute names/keys
 	PlaceHolderAttrName  = `placeholder`
@@ -59,37 +66,46 @@ const (
 	//some directory names
 	SavedFileLocation      = `saved`
 	ThumbnailsFileLocation = `thumbnails`
+	NovelsFileLocation     = `novels`
+	ReportsFileLocation    = `reports`
+
+	//some file name suffixes
+	UgoiraFileSuffix   = `_ugoira`
+	MetadataFileSuffix = `_meta.json`
 
+	//printed before the errors that happen before the logger is set up
 	ErrorMsgPrefix = `error:`
-	InfMsgPrefix   = `info:`
 
 	//time and duration
-	SavingRespWaitDura = time.Second * 6
+	SessionCheckTimeout  = time.Second * 15
+	PageLoadTimeout      = time.Second * 30
+	ImageResponseTimeout = time.Second * 15
+	ImageWriteTimeout    = time.Second * 60 //the longest wait for the next captured image to be written
+	NetworkIdleDura      = time.Millisecond * 500
+	ElementStableDura    = time.Second
 
 	//some file permission
-	WriteFilePermission = 0644
+	WriteFilePermission   = 0644
+	SessionFilePermission = 0600
+	DirPermission         = 0755
 
 	//some regex
 	artworkerImgReStr              = `(\d+)_p(\d+)\.(jpg|png|jpeg|gif)+` //this only match full res img
 	artworkIDReStr                 = `(\d+)_p`                           //this also match thumbnails
 	userProfileImgSrcReStr         = `https:\/\/i\.pximg\.net\/user-profile\/img\/(.+\.jpg)`
-	userPookmarkPageUrlSuffixReStr = `/users\/(\d+)\/bookmarks\/artworks\?*(p=(\d+))*`
+	userPookmarkPageUrlSuffixReStr = `/users\/(\d+)\/bookmarks\/artworks(?:\/[^?#]*)?(\?(?:.*&)?p=(\d+))?` //the page index can come after rest=hide, the bookmark tag before the query
 	arkworkerUrlSuffixReStr        = `\/artworks\/(\d+)`
+	userUrlSuffixReStr             = `\/users\/(\d+)`
 )
 
 var (
-	//some input modifier
-	NewTabMouseClickModifier = func() input.Modifier {
-		modifier := input.ModifierCtrl
-		if runtime.GOOS == "darwin" {
-			modifier = input.ModifierCommand
-		}
-		return modifier
-	}()
 	//some regex
 	ArtworkImgRe                = regexp.MustCompile(artworkerImgReStr)
 	ArtworkIDRe                 = regexp.MustCompile(artworkIDReStr)
 	UserProfileImgSrcRe         = regexp.MustCompile(userProfileImgSrcReStr)
 	UserBookmarkPageUrSuffixlRe = regexp.MustCompile(userPookmarkPageUrlSuffixReStr)
 	ArkworkerUrlSuffixRe        = regexp.MustCompile(arkworkerUrlSuffixReStr)
+	UserUrlSuffixRe             = regexp.MustCompile(userUrlSuffixReStr)
+	//texts of the page pixiv shows instead when requests come too fast
+	DefaultRateLimitPageTexts = []string{"Too Many Requests", "Rate Limit Exceeded"}
 )
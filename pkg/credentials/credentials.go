@@ -0,0 +1,117 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package credentials
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Sources are the places the password can come from, tried in the order of the fields.
+// Empty fields are skipped.
+type Sources struct {
+	Password       string //plain text, e.g. from the config file
+	PasswordFile   string //path of a file holding the password
+	PasswordEnv    string //name of an environment variable holding the password
+	PasswordCmd    string //shell command printing the password to stdout
+	EncryptedFile  string //path of a file written by Encrypt
+	PassphraseFile string //path of a file holding the passphrase of EncryptedFile
+	PassphraseEnv  string //name of an environment variable holding the passphrase of EncryptedFile
+}
+
+// Resolve returns the password from the first source that is set
+func Resolve(sources Sources) (password string, err error) {
+	switch {
+	case sources.Password != "":
+		return sources.Password, nil
+	case sources.PasswordFile != "":
+		return readSecretFile(sources.PasswordFile)
+	case sources.PasswordEnv != "":
+		password = os.Getenv(sources.PasswordEnv)
+		if password == "" {
+			return password, fmt.Errorf("environment variable $%s is empty", sources.PasswordEnv)
+		}
+		return password, nil
+	case sources.PasswordCmd != "":
+		return runPasswordCommand(sources.PasswordCmd)
+	case sources.EncryptedFile != "":
+		passphrase, err := ResolvePassphrase(sources)
+		if err != nil {
+			return password, err
+		}
+		return DecryptFile(sources.EncryptedFile, passphrase)
+	}
+	return password, fmt.Errorf("no password source is set")
+}
+
+// ResolvePassphrase returns the passphrase of the encrypted credentials file
+func ResolvePassphrase(sources Sources) (passphrase string, err error) {
+	if sources.PassphraseFile != "" {
+		return readSecretFile(sources.PassphraseFile)
+	}
+	if sources.PassphraseEnv != "" {
+		passphrase = os.Getenv(sources.PassphraseEnv)
+		if passphrase != "" {
+			return passphrase, nil
+		}
+	}
+	return passphrase, fmt.Errorf("no passphrase for the encrypted credentials file: set a passphrase file or $%s", sources.PassphraseEnv)
+}
+
+func readSecretFile(path string) (secret string, err error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return secret, fmt.Errorf("unable to read secret file \"%s\": %+v", path, err)
+	}
+	secret = strings.TrimRight(string(buf), "\r\n")
+	if secret == "" {
+		return secret, fmt.Errorf("secret file \"%s\" is empty", path)
+	}
+	return secret, nil
+}
+
+func runPasswordCommand(command string) (password string, err error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		//the command itself is not in the error in case the secret is passed on the command line
+		return password, fmt.Errorf("password command failed: %+v", err)
+	}
+	password = strings.TrimRight(stdout.String(), "\r\n")
+	if password == "" {
+		return password, fmt.Errorf("password command printed nothing")
+	}
+	return password, nil
+}
@@ -0,0 +1,159 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	encryptedFileVersion    = 1
+	encryptedFilePermission = 0600
+	kdfScrypt               = `scrypt`
+	saltLength              = 16
+	keyLength               = 32 //AES-256
+
+	//recommended scrypt parameters for interactive logins
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// encryptedFile is the format of the credentials file. []byte fields are base64 in json.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	Kdf        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func newGcm(passphrase string, salt []byte, n, r, p int) (gcm cipher.AEAD, err error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, keyLength)
+	if err != nil {
+		return gcm, fmt.Errorf("unable to derive key from passphrase: %+v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return gcm, fmt.Errorf("unable to create cipher: %+v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptFile encrypts password with a key derived from passphrase and writes it to path
+func EncryptFile(path string, password string, passphrase string) (err error) {
+	f := encryptedFile{
+		Version: encryptedFileVersion,
+		Kdf:     kdfScrypt,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, saltLength),
+	}
+	_, err = rand.Read(f.Salt)
+	if err != nil {
+		return fmt.Errorf("unable to generate salt: %+v", err)
+	}
+	gcm, err := newGcm(passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	_, err = rand.Read(f.Nonce)
+	if err != nil {
+		return fmt.Errorf("unable to generate nonce: %+v", err)
+	}
+	f.Ciphertext = gcm.Seal(nil, f.Nonce, []byte(password), nil)
+
+	buf, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal credentials file: %+v", err)
+	}
+	//written to a temp file created 0600 and renamed, as WriteFile keeps the mode of an existing file
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.part")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file for credentials file \"%s\": %+v", path, err)
+	}
+	_, err = tmp.Write(buf)
+	if err == nil {
+		err = tmp.Chmod(encryptedFilePermission)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write credentials file \"%s\": %+v", path, err)
+	}
+	return nil
+}
+
+// DecryptFile reads the password from a file written by EncryptFile
+func DecryptFile(path string, passphrase string) (password string, err error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return password, fmt.Errorf("unable to read credentials file \"%s\": %+v", path, err)
+	}
+	var f encryptedFile
+	err = json.Unmarshal(buf, &f)
+	if err != nil {
+		return password, fmt.Errorf("unable to unmarshal credentials file \"%s\": %+v", path, err)
+	}
+	if f.Version != encryptedFileVersion || f.Kdf != kdfScrypt {
+		return password, fmt.Errorf("unsupported credentials file \"%s\": version %d, kdf \"%s\"", path, f.Version, f.Kdf)
+	}
+	//scrypt takes 128*N*R bytes, so a tampered file must not pick its parameters
+	if f.N != scryptN || f.R != scryptR || f.P != scryptP {
+		return password, fmt.Errorf("unsupported scrypt parameters in credentials file \"%s\": n %d, r %d, p %d", path, f.N, f.R, f.P)
+	}
+	gcm, err := newGcm(passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return password, err
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return password, fmt.Errorf("invalid nonce in credentials file \"%s\"", path)
+	}
+	plaintext, err := gcm.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return password, fmt.Errorf("unable to decrypt credentials file \"%s\": wrong passphrase or corrupted file", path)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,150 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package credentials
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEncryptFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	err := EncryptFile(path, "p@ss word", "passphrase")
+	if err != nil {
+		t.Fatalf("EncryptFile() error = %+v", err)
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %+v", err)
+	}
+	if strings.Contains(string(buf), "p@ss word") {
+		t.Errorf("credentials file holds the password in plain text: %s", buf)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat() error = %+v", err)
+		}
+		if mode := info.Mode().Perm(); mode != encryptedFilePermission {
+			t.Errorf("credentials file mode = %o, want %o", mode, encryptedFilePermission)
+		}
+	}
+
+	password, err := DecryptFile(path, "passphrase")
+	if err != nil {
+		t.Fatalf("DecryptFile() error = %+v", err)
+	}
+	if password != "p@ss word" {
+		t.Errorf("DecryptFile() = %q, want %q", password, "p@ss word")
+	}
+}
+
+func TestDecryptFileWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	err := EncryptFile(path, "password", "passphrase")
+	if err != nil {
+		t.Fatalf("EncryptFile() error = %+v", err)
+	}
+
+	password, err := DecryptFile(path, "not the passphrase")
+	if err == nil {
+		t.Fatalf("DecryptFile() = %q, want an error", password)
+	}
+	if !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("DecryptFile() error = %+v, want it to tell about a wrong passphrase", err)
+	}
+}
+
+func TestEncryptFileTightensExistingMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	err := ioutil.WriteFile(path, []byte("{}"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile() error = %+v", err)
+	}
+	err = EncryptFile(path, "password", "passphrase")
+	if err != nil {
+		t.Fatalf("EncryptFile() error = %+v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %+v", err)
+	}
+	if mode := info.Mode().Perm(); mode != encryptedFilePermission {
+		t.Errorf("credentials file mode = %o, want %o", mode, encryptedFilePermission)
+	}
+}
+
+func TestDecryptFileRejectsScryptParameters(t *testing.T) {
+	tests := []struct {
+		name    string
+		n, r, p int
+	}{
+		{"huge n", 1 << 30, scryptR, scryptP},
+		{"huge r", scryptN, 1 << 20, scryptP},
+		{"huge p", scryptN, scryptR, 1 << 20},
+		{"zero n", 0, scryptR, scryptP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "credentials.json")
+			err := EncryptFile(path, "password", "passphrase")
+			if err != nil {
+				t.Fatalf("EncryptFile() error = %+v", err)
+			}
+			buf, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %+v", err)
+			}
+			var f encryptedFile
+			err = json.Unmarshal(buf, &f)
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %+v", err)
+			}
+			f.N, f.R, f.P = tt.n, tt.r, tt.p
+			buf, err = json.Marshal(f)
+			if err != nil {
+				t.Fatalf("Marshal() error = %+v", err)
+			}
+			err = ioutil.WriteFile(path, buf, encryptedFilePermission)
+			if err != nil {
+				t.Fatalf("WriteFile() error = %+v", err)
+			}
+
+			password, err := DecryptFile(path, "passphrase")
+			if err == nil {
+				t.Fatalf("DecryptFile() = %q, want an error", password)
+			}
+			if !strings.Contains(err.Error(), "scrypt parameters") {
+				t.Errorf("DecryptFile() error = %+v, want it to reject the scrypt parameters", err)
+			}
+		})
+	}
+}
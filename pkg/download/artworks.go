@@ -24,13 +24,18 @@ package download
 import (
 	"context"
 	"fmt"
-	"path"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/paths"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
 )
 
 func ListenForNetworkEventAndDownloadBookmarkThumbnails(ctx context.Context) (waitFunc func(common.UrlMap) error) {
@@ -56,15 +61,20 @@ func ListenForNetworkEventAndDownloadBookmarkThumbnails(ctx context.Context) (wa
 		if filenamePrefix == "" {
 			return filePath, false
 		}
-		filename := path.Base(url)
-		filePath = fmt.Sprintf("%s/%s", config.ThumbnailsFileLocation, filename)
+		filePath, err := common.GetThumbnailPath(url)
+		if err != nil {
+			logging.FromContext(ctx).Error("unable to get thumbnail path", logging.KeyUrl, url, logging.KeyError, err)
+			return filePath, false
+		}
 		return filePath, true
 	}
 
-	return listenForNetworkEventAndDownloadImages(ctx, urlMatcher)
+	return listenForNetworkEventAndDownloadImages(ctx, urlMatcher, nil)
 }
 
-func ListenForNetworkEventAndDownloadArtworkImage(ctx context.Context) (waitFunc func(common.UrlMap) error) {
+// ListenForNetworkEventAndDownloadArtworkImage saves the full res images loaded by the page.
+// artworkValues fill the variables of the saved path template that are not in the image url.
+func ListenForNetworkEventAndDownloadArtworkImage(ctx context.Context, artworkValues paths.Values) (waitFunc func(common.UrlMap) error) {
 	//do not do duplicate download
 	var mutex sync.Mutex
 	downloadedUrls := make(map[string]struct{})
@@ -87,16 +97,30 @@ func ListenForNetworkEventAndDownloadArtworkImage(ctx context.Context) (waitFunc
 		if artworkID == "" {
 			return filePath, false
 		}
-		filename := path.Base(url)
-		filePath = fmt.Sprintf("%s/%s", config.SavedFileLocation, filename)
+		filePath, err := common.GetArtworkPagePath(artworkValues, url)
+		if err != nil {
+			logging.FromContext(ctx).Error("unable to get artwork page path", logging.KeyUrl, url, logging.KeyError, err)
+			return filePath, false
+		}
 		return filePath, true
 	}
 
-	return listenForNetworkEventAndDownloadImages(ctx, urlMatcher)
+	onSaved := func(url string, filePath string) {
+		artworkID := common.Get1stGroupMatch(url, config.ArtworkImgRe)
+		page, err := strconv.Atoi(common.Get2ndGroupMatch(url, config.ArtworkImgRe))
+		if err != nil {
+			return
+		}
+		state.Downloads.AddPage(artworkID, page, filePath)
+		//the number of pages is only known to the caller
+		progress.Emit(progress.Event{Kind: progress.PageSaved, ID: artworkID, ArtworkPage: page + 1, Path: filePath})
+	}
+
+	return listenForNetworkEventAndDownloadImages(ctx, urlMatcher, onSaved)
 }
 
 func listenForNetworkEventAndDownloadImages(ctx context.Context,
-	urlMatcher func(string) (string, bool)) (waitFunc func(common.UrlMap) error) {
+	urlMatcher func(string) (string, bool), onSaved func(string, string)) (waitFunc func(common.UrlMap) error) {
 
 	waitItemChan := make(chan string, 100)
 	var errs common.Errors
@@ -110,13 +134,17 @@ func listenForNetworkEventAndDownloadImages(ctx context.Context,
 			isEventQueueClosed = true
 			mutex.Unlock()
 		}()
-		fmt.Printf("waiting writing %d files to be done\n", len(urls))
-		fmt.Printf("debug: len(waitItemChan)=%d\n", len(waitItemChan))
+		logging.FromContext(ctx).Debug("waiting for files to be written", "files", len(urls), "written", len(waitItemChan))
 		for len(urls) > 0 {
-			url := <-waitItemChan
-			_, ok := urls[url]
-			if ok {
+			select {
+			case url := <-waitItemChan:
 				delete(urls, url)
+			case <-time.After(config.ImageWriteTimeout):
+				//e.g. an expected image was never requested
+				return common.ConcatenateErrors(errs.Get(),
+					fmt.Errorf("timed out after %s waiting for %d files to be written", config.ImageWriteTimeout, len(urls)))
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 		}
 		return errs.Get()
@@ -146,19 +174,27 @@ func listenForNetworkEventAndDownloadImages(ctx context.Context,
 				}
 
 				requestID := ev.RequestID
-				fmt.Printf("registering event: requestID: \"%s\", url=\"%s\"\n", requestID, url)
+				mimeType := resp.MimeType
+				logger := logging.FromContext(ctx).With(logging.KeyRequest, string(requestID))
+				if page := common.Get2ndGroupMatch(url, config.ArtworkImgRe); page != "" {
+					logger = logger.With(logging.KeyPage, page)
+				}
+				logger.Debug("registering event", logging.KeyUrl, url)
 				Manager.RegisterEvent(requestID, func() (selfRemove bool, err error) {
 					defer func() {
 						waitItemChan <- url
 					}()
-					fmt.Printf("start writing to file: requestID: \"%s\", filePath=\"%s\"\n", requestID, filePath)
-					err = common.StartSavingResponseToFile(ctx, requestID, filePath)
-					fmt.Printf("finish writing to file: requestID: \"%s\", filePath=\"%s\"\n", requestID, filePath)
+					logger.Debug("start writing to file", logging.KeyPath, filePath)
+					err = common.StartSavingResponseToFile(logging.NewContext(ctx, logger), requestID, filePath, mimeType)
+					logger.Debug("finish writing to file", logging.KeyPath, filePath)
+					if err == nil && onSaved != nil {
+						onSaved(url, filePath)
+					}
 					return true, err
 				})
 			case *network.EventLoadingFinished:
 				requestID := ev.RequestID
-				fmt.Printf("trigger event: requestID: \"%s\"\n", requestID)
+				logging.FromContext(ctx).Debug("trigger event", logging.KeyRequest, string(requestID))
 				errs.Add(Manager.TriggerEventIfExist(requestID))
 			}
 		}
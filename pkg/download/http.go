@@ -0,0 +1,267 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
+)
+
+const (
+	DefaultMaxDownloads = 4
+
+	partFileSuffix = `.part`
+)
+
+// DownloadStatus tells what a download did
+type DownloadStatus int
+
+const (
+	Downloaded  DownloadStatus = iota //the whole file was fetched
+	Resumed                           //the rest of a partial file was fetched
+	NotModified                       //the saved file is still up to date
+)
+
+func (s DownloadStatus) String() string {
+	switch s {
+	case Downloaded:
+		return "downloaded"
+	case Resumed:
+		return "resumed"
+	case NotModified:
+		return "not modified"
+	}
+	return fmt.Sprintf("DownloadStatus(%d)", int(s))
+}
+
+var (
+	Direct = NewDirectDownloader(http.DefaultClient, DefaultMaxDownloads)
+)
+
+// DirectDownloader fetches original image urls with net/http instead of capturing them from the browser.
+// The body is streamed to a .part file next to the destination, which a later attempt resumes with a
+// Range request. A saved file is only fetched again when the server says it was modified.
+type DirectDownloader struct {
+	Client  *http.Client
+	Referer string
+	limit   chan struct{}
+}
+
+// NewDirectDownloader creates a downloader running at most maxConcurrent downloads at the same time
+func NewDirectDownloader(client *http.Client, maxConcurrent int) *DirectDownloader {
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxDownloads
+	}
+	return &DirectDownloader{
+		Client:  client,
+		Referer: config.PixivReferer,
+		limit:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+// NewCookieJar puts the cookies of the browser into a jar, so that requests carry the session
+func NewCookieJar(cookies []*network.Cookie) (jar http.CookieJar, err error) {
+	cookieJar, err := cookiejar.New(nil)
+	if err != nil {
+		return jar, fmt.Errorf("unable to create cookie jar: %+v", err)
+	}
+	for _, cookie := range cookies {
+		host := strings.TrimPrefix(cookie.Domain, ".")
+		u := &url.URL{Scheme: "https", Host: host, Path: "/"}
+		httpCookie := &http.Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HTTPOnly,
+		}
+		//a leading dot means the cookie is for the subdomains too
+		if strings.HasPrefix(cookie.Domain, ".") {
+			httpCookie.Domain = host
+		}
+		cookieJar.SetCookies(u, []*http.Cookie{httpCookie})
+	}
+	return cookieJar, nil
+}
+
+// Download fetches rawUrl into filePath, retrying and resuming on failures
+func (d *DirectDownloader) Download(ctx context.Context, rawUrl string, filePath string) (status DownloadStatus, err error) {
+	select {
+	case d.limit <- struct{}{}:
+	case <-ctx.Done():
+		return status, ctx.Err()
+	}
+	defer func() {
+		<-d.limit
+	}()
+
+	err = common.Retry(ctx, "downloading "+rawUrl, func() (err error) {
+		status, err = d.download(ctx, rawUrl, filePath)
+		return err
+	})
+	if err != nil {
+		return status, err
+	}
+	if status != NotModified {
+		logging.FromContext(ctx).Info("downloaded file", "status", status.String(), logging.KeyPath, filePath)
+	}
+	return status, nil
+}
+
+func (d *DirectDownloader) download(ctx context.Context, rawUrl string, filePath string) (status DownloadStatus, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return status, common.Permanent(fmt.Errorf("unable to create request for \"%s\": %+v", rawUrl, err))
+	}
+	if d.Referer != "" {
+		req.Header.Set("Referer", d.Referer)
+	}
+
+	partPath := filePath + partFileSuffix
+	var offset int64
+	if info, err := os.Stat(filePath); err == nil {
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	} else if info, err := os.Stat(partPath); err == nil && info.Size() > 0 {
+		//the part file carries the Last-Modified of the response it came from,
+		//the server sends the whole file instead when it no longer matches
+		offset = info.Size()
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+
+	err = schedule.Scheduler.Wait(ctx)
+	if err != nil {
+		return status, err
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return status, fmt.Errorf("failed to GET \"%s\": %+v", rawUrl, err)
+	}
+	defer resp.Body.Close()
+
+	var flag int
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return NotModified, nil
+	case http.StatusOK:
+		status = Downloaded
+		flag = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	case http.StatusPartialContent:
+		status = Resumed
+		flag = os.O_WRONLY | os.O_APPEND
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			os.Remove(partPath)
+			return status, fmt.Errorf("GET \"%s\" returned range \"%s\" for offset %d", rawUrl, resp.Header.Get("Content-Range"), offset)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		//the part file is already whole, or it is longer than the file now is
+		status = Resumed
+	default:
+		if schedule.IsThrottleStatus(resp.StatusCode) {
+			schedule.Scheduler.Throttled(fmt.Sprintf("status %d for \"%s\"", resp.StatusCode, rawUrl))
+		}
+		return status, &api.StatusError{Url: rawUrl, StatusCode: resp.StatusCode}
+	}
+
+	if flag != 0 {
+		err = writePart(partPath, flag, resp)
+		if err != nil {
+			return status, err
+		}
+	}
+	return status, commitPart(partPath, filePath, resp.Header.Get("Content-Type"))
+}
+
+// writePart streams the body to the part file. What was written before a failure is kept for resuming.
+func writePart(partPath string, flag int, resp *http.Response) (err error) {
+	f, err := os.OpenFile(partPath, flag, config.WriteFilePermission)
+	if err != nil {
+		return fmt.Errorf("unable to open \"%s\": %+v", partPath, err)
+	}
+	_, err = io.Copy(&progressWriter{w: f, path: strings.TrimSuffix(partPath, partFileSuffix)}, resp.Body)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if lastModified, parseErr := http.ParseTime(resp.Header.Get("Last-Modified")); parseErr == nil {
+		os.Chtimes(partPath, time.Now(), lastModified)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to \"%s\": %+v", partPath, err)
+	}
+	return nil
+}
+
+// progressWriter emits what is written to w as it is written
+type progressWriter struct {
+	w    io.Writer
+	path string
+}
+
+func (pw *progressWriter) Write(buf []byte) (n int, err error) {
+	n, err = pw.w.Write(buf)
+	if n > 0 {
+		progress.Emit(progress.Event{Kind: progress.BytesWritten, Path: pw.path, Bytes: int64(n)})
+	}
+	return n, err
+}
+
+// commitPart verifies the whole part file, records it in the manifest and renames it to filePath
+func commitPart(partPath string, filePath string, mimeType string) (err error) {
+	//a resumed response only carries the content type of its range
+	if strings.HasPrefix(mimeType, "multipart/") {
+		mimeType = ""
+	}
+	err = common.VerifySavedFile(partPath, filePath, mimeType)
+	if err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("refusing to keep \"%s\": %+v", filePath, err)
+	}
+	size, sum, err := common.ChecksumFile(partPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(partPath, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to move \"%s\" to \"%s\": %+v", partPath, filePath, err)
+	}
+	return state.Manifest.Add(filePath, size, sum)
+}
@@ -0,0 +1,310 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
+)
+
+var modTime = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	schedule.Scheduler.Configure(time.Millisecond, time.Millisecond, time.Millisecond)
+	os.Exit(m.Run())
+}
+
+func newTestImage(t *testing.T) []byte {
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %+v", err)
+	}
+	return buf.Bytes()
+}
+
+type imageServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []*http.Request
+}
+
+// newImageServer serves content at /img.png like i.pximg.net does: only with the right referer
+func newImageServer(t *testing.T, content []byte) *imageServer {
+	return newFileServer(t, "img.png", "image/png", content)
+}
+
+// newFileServer serves content at /name with mimeType, e.g. an ugoira zip
+func newFileServer(t *testing.T, name string, mimeType string, content []byte) *imageServer {
+	s := &imageServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requests = append(s.requests, r)
+		s.lock.Unlock()
+		if r.Header.Get("Referer") != config.PixivReferer {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/"+name {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", mimeType)
+		http.ServeContent(w, r, name, modTime, bytes.NewReader(content))
+	}))
+	return s
+}
+
+func (s *imageServer) lastRequest(t *testing.T) *http.Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.requests) <= 0 {
+		t.Fatalf("no request was made")
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+func readFile(t *testing.T, path string) []byte {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %+v", err)
+	}
+	return buf
+}
+
+func TestDownload(t *testing.T) {
+	content := newTestImage(t)
+	server := newImageServer(t, content)
+	defer server.Close()
+
+	jar, err := NewCookieJar([]*network.Cookie{{Name: "PHPSESSID", Value: "secret", Domain: "127.0.0.1", Path: "/"}})
+	if err != nil {
+		t.Fatalf("NewCookieJar() error = %+v", err)
+	}
+	d := NewDirectDownloader(&http.Client{Jar: jar}, 2)
+
+	filePath := filepath.Join(t.TempDir(), "img.png")
+	status, err := d.Download(context.Background(), server.URL+"/img.png", filePath)
+	if err != nil {
+		t.Fatalf("Download() error = %+v", err)
+	}
+	if status != Downloaded {
+		t.Errorf("Download() status = %s, want %s", status, Downloaded)
+	}
+	if !bytes.Equal(readFile(t, filePath), content) {
+		t.Errorf("downloaded file differs from the served one")
+	}
+	if _, err := os.Stat(filePath + partFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("part file left behind: %+v", err)
+	}
+	if cookie, err := server.lastRequest(t).Cookie("PHPSESSID"); err != nil || cookie.Value != "secret" {
+		t.Errorf("session cookie not sent: %+v", err)
+	}
+}
+
+func TestDownloadZip(t *testing.T) {
+	var content bytes.Buffer
+	zw := zip.NewWriter(&content)
+	fw, err := zw.Create("000000.jpg")
+	if err != nil {
+		t.Fatalf("Create() error = %+v", err)
+	}
+	if _, err := fw.Write(newTestImage(t)); err != nil {
+		t.Fatalf("Write() error = %+v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close() error = %+v", err)
+	}
+	server := newFileServer(t, "ugoira.zip", "application/zip", content.Bytes())
+	defer server.Close()
+	d := NewDirectDownloader(server.Client(), 2)
+
+	filePath := filepath.Join(t.TempDir(), "ugoira.zip")
+	status, err := d.Download(context.Background(), server.URL+"/ugoira.zip", filePath)
+	if err != nil {
+		t.Fatalf("Download() error = %+v", err)
+	}
+	if status != Downloaded {
+		t.Errorf("Download() status = %s, want %s", status, Downloaded)
+	}
+	if !bytes.Equal(readFile(t, filePath), content.Bytes()) {
+		t.Errorf("downloaded zip differs from the served one")
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := newTestImage(t)
+	server := newImageServer(t, content)
+	defer server.Close()
+	d := NewDirectDownloader(server.Client(), 2)
+
+	filePath := filepath.Join(t.TempDir(), "img.png")
+	half := int64(len(content) / 2)
+	if err := ioutil.WriteFile(filePath+partFileSuffix, content[:half], 0644); err != nil {
+		t.Fatalf("WriteFile() error = %+v", err)
+	}
+	if err := os.Chtimes(filePath+partFileSuffix, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes() error = %+v", err)
+	}
+
+	status, err := d.Download(context.Background(), server.URL+"/img.png", filePath)
+	if err != nil {
+		t.Fatalf("Download() error = %+v", err)
+	}
+	if status != Resumed {
+		t.Errorf("Download() status = %s, want %s", status, Resumed)
+	}
+	if got := server.lastRequest(t).Header.Get("Range"); got != "bytes="+strconv.FormatInt(half, 10)+"-" {
+		t.Errorf("Range = %q, want bytes=%d-", got, half)
+	}
+	if !bytes.Equal(readFile(t, filePath), content) {
+		t.Errorf("resumed file differs from the served one")
+	}
+}
+
+func TestDownloadResumeChanged(t *testing.T) {
+	content := newTestImage(t)
+	server := newImageServer(t, content)
+	defer server.Close()
+	d := NewDirectDownloader(server.Client(), 2)
+
+	//a part of an older version of the file must not be resumed
+	filePath := filepath.Join(t.TempDir(), "img.png")
+	if err := ioutil.WriteFile(filePath+partFileSuffix, []byte("stale bytes"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %+v", err)
+	}
+	old := modTime.Add(-time.Hour)
+	if err := os.Chtimes(filePath+partFileSuffix, old, old); err != nil {
+		t.Fatalf("Chtimes() error = %+v", err)
+	}
+
+	status, err := d.Download(context.Background(), server.URL+"/img.png", filePath)
+	if err != nil {
+		t.Fatalf("Download() error = %+v", err)
+	}
+	if status != Downloaded {
+		t.Errorf("Download() status = %s, want %s", status, Downloaded)
+	}
+	if !bytes.Equal(readFile(t, filePath), content) {
+		t.Errorf("downloaded file differs from the served one")
+	}
+}
+
+func TestDownloadNotModified(t *testing.T) {
+	content := newTestImage(t)
+	server := newImageServer(t, content)
+	defer server.Close()
+	d := NewDirectDownloader(server.Client(), 2)
+
+	filePath := filepath.Join(t.TempDir(), "img.png")
+	if _, err := d.Download(context.Background(), server.URL+"/img.png", filePath); err != nil {
+		t.Fatalf("Download() error = %+v", err)
+	}
+	status, err := d.Download(context.Background(), server.URL+"/img.png", filePath)
+	if err != nil {
+		t.Fatalf("second Download() error = %+v", err)
+	}
+	if status != NotModified {
+		t.Errorf("second Download() status = %s, want %s", status, NotModified)
+	}
+	if got := server.lastRequest(t).Header.Get("If-Modified-Since"); got != modTime.Format(http.TimeFormat) {
+		t.Errorf("If-Modified-Since = %q, want %q", got, modTime.Format(http.TimeFormat))
+	}
+}
+
+func TestDownloadRejectsNonImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>please login</html>"))
+	}))
+	defer server.Close()
+	d := NewDirectDownloader(server.Client(), 2)
+
+	filePath := filepath.Join(t.TempDir(), "img.png")
+	_, err := d.download(context.Background(), server.URL+"/img.png", filePath)
+	if err == nil {
+		t.Fatalf("download() of an html page succeeded")
+	}
+	for _, path := range []string{filePath, filePath + partFileSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("\"%s\" exists after a rejected download", path)
+		}
+	}
+}
+
+func TestDownloadConcurrencyLimit(t *testing.T) {
+	content := newTestImage(t)
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(content)
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+	}))
+	defer server.Close()
+	d := NewDirectDownloader(server.Client(), 2)
+
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			filePath := filepath.Join(dir, strconv.Itoa(i)+".png")
+			if _, err := d.Download(context.Background(), server.URL+"/img.png", filePath); err != nil {
+				t.Errorf("Download() error = %+v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if maxInFlight > 2 {
+		t.Errorf("%d downloads ran at the same time, want at most 2", maxInFlight)
+	}
+}
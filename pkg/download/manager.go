@@ -51,9 +51,6 @@ func (manager *eventManager) RegisterEvent(requestID network.RequestID, eh Event
 
 func (manager *eventManager) triggerEvent(requestID network.RequestID,
 	errFuncWhenEventNotExist func(network.RequestID, Event) error) (err error) {
-	manager.eventsMutex.Lock()
-	defer manager.eventsMutex.Unlock()
-
 	if errFuncWhenEventNotExist == nil {
 		//avoid panic
 		errFuncWhenEventNotExist = func(requestID network.RequestID, ev Event) error {
@@ -61,17 +58,19 @@ func (manager *eventManager) triggerEvent(requestID network.RequestID,
 		}
 	}
 
+	manager.eventsMutex.Lock()
 	event, exist := manager.events[requestID]
+	manager.eventsMutex.Unlock()
 	if !exist {
 		return errFuncWhenEventNotExist(requestID, event)
 	}
-	var selfRemove bool
-	defer func() {
-		if selfRemove {
-			delete(manager.events, requestID)
-		}
-	}()
-	selfRemove, err = event.handle()
+	//the handle runs unlocked so that tabs can save their files at the same time
+	selfRemove, err := event.handle()
+	if selfRemove {
+		manager.eventsMutex.Lock()
+		delete(manager.events, requestID)
+		manager.eventsMutex.Unlock()
+	}
 	return err
 }
 
@@ -0,0 +1,293 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is how important a log line is
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// the output formats
+const (
+	FormatText = `text`
+	FormatJson = `json`
+)
+
+// the field keys used across packages, so that a log collector can rely on them
+const (
+	KeyArtwork = `artwork`
+	KeyNovel   = `novel`
+	KeyUser    = `user`
+	KeyPage    = `page`
+	KeyRequest = `request`
+	KeyTab     = `tab`
+	KeyUrl     = `url`
+	KeyPath    = `path`
+	KeyError   = `error`
+)
+
+const (
+	timeLayout = `2006-01-02T15:04:05.000Z07:00`
+	badKey     = `!BADKEY`
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(str string) (level Level, err error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(str, name) {
+			return Level(i), nil
+		}
+	}
+	return level, fmt.Errorf("unknown log level \"%s\", it should be one of %s", str, strings.Join(levelNames, ", "))
+}
+
+// sink is where the loggers derived from one another write to
+type sink struct {
+	lock   sync.Mutex
+	out    io.Writer
+	level  Level
+	format string
+}
+
+// Logger writes leveled lines with key value fields. It is safe to use from several goroutines.
+type Logger struct {
+	sink   *sink
+	fields []interface{} //key, value, key, value...
+}
+
+var (
+	// Default is what the package level functions and FromContext without a logger use
+	Default = New(os.Stderr, LevelInfo, FormatText)
+)
+
+// New makes a logger writing lines of at least level to out in format
+func New(out io.Writer, level Level, format string) *Logger {
+	return &Logger{sink: &sink{out: out, level: level, format: format}}
+}
+
+// Configure changes where and what the logger and every logger derived from it write
+func (l *Logger) Configure(out io.Writer, level Level, format string) {
+	l.sink.lock.Lock()
+	defer l.sink.lock.Unlock()
+	l.sink.out = out
+	l.sink.level = level
+	l.sink.format = format
+}
+
+// SetOutput changes where the logger and every logger derived from it write
+func (l *Logger) SetOutput(out io.Writer) {
+	l.sink.lock.Lock()
+	defer l.sink.lock.Unlock()
+	l.sink.out = out
+}
+
+// With is a logger adding the key value pairs to every line
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValues...)
+	return &Logger{sink: l.sink, fields: fields}
+}
+
+// Enabled tells if lines of level are written
+func (l *Logger) Enabled(level Level) bool {
+	l.sink.lock.Lock()
+	defer l.sink.lock.Unlock()
+	return level >= l.sink.level
+}
+
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.log(LevelDebug, msg, keyValues)
+}
+
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.log(LevelInfo, msg, keyValues)
+}
+
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.log(LevelWarn, msg, keyValues)
+}
+
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.log(LevelError, msg, keyValues)
+}
+
+func (l *Logger) log(level Level, msg string, keyValues []interface{}) {
+	l.sink.lock.Lock()
+	defer l.sink.lock.Unlock()
+	if level < l.sink.level {
+		return
+	}
+	fields := append(append([]interface{}{}, l.fields...), keyValues...)
+	var line []byte
+	if l.sink.format == FormatJson {
+		line = formatJson(time.Now(), level, msg, fields)
+	} else {
+		line = formatText(time.Now(), level, msg, fields)
+	}
+	//nowhere to report a failed write to
+	_, _ = l.sink.out.Write(line)
+}
+
+// pairs calls f on every key value pair. A key without a value gets an empty value, a key that is not a string is badKey.
+func pairs(fields []interface{}, f func(key string, val interface{})) {
+	for i := 0; i < len(fields); i += 2 {
+		key, ok := fields[i].(string)
+		if !ok {
+			key = badKey
+		}
+		var val interface{}
+		if i+1 < len(fields) {
+			val = fields[i+1]
+		}
+		f(key, val)
+	}
+}
+
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return fmt.Sprintf("%+v", v)
+	case time.Duration:
+		return v.String()
+	}
+	return fmt.Sprint(val)
+}
+
+func quoteIfNeeded(str string) string {
+	if str == "" || strings.ContainsAny(str, " \t\r\n\"=") {
+		return strconv.Quote(str)
+	}
+	return str
+}
+
+// formatText makes a line such as: 2022-01-02T15:04:05.000Z INFO saved page artwork=123 page=0
+func formatText(now time.Time, level Level, msg string, fields []interface{}) []byte {
+	var b bytes.Buffer
+	b.WriteString(now.Format(timeLayout))
+	b.WriteByte(' ')
+	b.WriteString(strings.ToUpper(level.String()))
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	pairs(fields, func(key string, val interface{}) {
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(quoteIfNeeded(formatValue(val)))
+	})
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// formatJson makes a json object per line with the time, level and msg first
+func formatJson(now time.Time, level Level, msg string, fields []interface{}) []byte {
+	var b bytes.Buffer
+	writeField := func(key string, val interface{}) {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		} else {
+			b.WriteByte('{')
+		}
+		keyBuf, _ := json.Marshal(key)
+		b.Write(keyBuf)
+		b.WriteByte(':')
+		switch val.(type) {
+		case nil, string, bool, int, int64, float64:
+		default:
+			val = formatValue(val)
+		}
+		valBuf, err := json.Marshal(val)
+		if err != nil {
+			valBuf, _ = json.Marshal(fmt.Sprint(val))
+		}
+		b.Write(valBuf)
+	}
+	writeField("time", now.Format(timeLayout))
+	writeField("level", level.String())
+	writeField("msg", msg)
+	pairs(fields, writeField)
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+type loggerKey struct{}
+
+// NewContext carries l in ctx
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext is the logger carried in ctx, or Default
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return Default
+}
+
+func Debug(msg string, keyValues ...interface{}) {
+	Default.log(LevelDebug, msg, keyValues)
+}
+
+func Info(msg string, keyValues ...interface{}) {
+	Default.log(LevelInfo, msg, keyValues)
+}
+
+func Warn(msg string, keyValues ...interface{}) {
+	Default.log(LevelWarn, msg, keyValues)
+}
+
+func Error(msg string, keyValues ...interface{}) {
+	Default.log(LevelError, msg, keyValues)
+}
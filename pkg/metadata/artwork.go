@@ -0,0 +1,125 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+)
+
+// Artist is the author of an artwork
+type Artist struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Tag is a tag of an artwork with its translations keyed by language
+type Tag struct {
+	Name         string            `json:"name"`
+	Translations map[string]string `json:"translations,omitempty"`
+}
+
+// Bookmark is what we attached to the artwork when bookmarking it
+type Bookmark struct {
+	ID      string   `json:"id,omitempty"`
+	Private bool     `json:"private"`
+	Date    string   `json:"date,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+// Artwork is the sidecar written next to the images of an artwork
+type Artwork struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Caption    string    `json:"caption"`
+	Artist     Artist    `json:"artist"`
+	Tags       []Tag     `json:"tags"`
+	CreateDate string    `json:"createDate"`
+	UploadDate string    `json:"uploadDate"`
+	PageCount  int       `json:"pageCount"`
+	IllustType int       `json:"illustType"`
+	R18        bool      `json:"r18"`
+	R18G       bool      `json:"r18g"`
+	Ai         bool      `json:"ai"`
+	Bookmark   *Bookmark `json:"bookmark,omitempty"`
+	//public or private, when it was found through the bookmarks
+	BookmarkList string `json:"bookmarkList,omitempty"`
+	SourceUrl    string `json:"sourceUrl"`
+}
+
+// NewArtwork builds the sidecar from the artwork detail. bookmark can be nil.
+func NewArtwork(illust api.Illust, bookmark *api.BookmarkDetail, sourceUrl string) Artwork {
+	artwork := Artwork{
+		ID:      string(illust.ID),
+		Title:   illust.Title,
+		Caption: illust.Comment,
+		Artist: Artist{
+			ID:   string(illust.UserID),
+			Name: illust.UserName,
+		},
+		Tags:       []Tag{},
+		CreateDate: illust.CreateDate,
+		UploadDate: illust.UploadDate,
+		PageCount:  illust.PageCount,
+		IllustType: illust.IllustType,
+		R18:        illust.XRestrict == api.XRestrictR18,
+		R18G:       illust.XRestrict == api.XRestrictR18G,
+		Ai:         illust.AiType == api.AiTypeAi,
+		SourceUrl:  sourceUrl,
+	}
+	for _, tag := range illust.Tags.Tags {
+		artwork.Tags = append(artwork.Tags, Tag{Name: tag.Tag, Translations: tag.Translation})
+	}
+
+	if bookmark != nil {
+		artwork.Bookmark = &Bookmark{
+			ID:      string(bookmark.ID),
+			Private: bookmark.Private,
+			Date:    bookmark.CreateDate,
+			Tags:    bookmark.Tags,
+			Comment: bookmark.Comment,
+		}
+	} else if illust.BookmarkData != nil {
+		artwork.Bookmark = &Bookmark{
+			ID:      string(illust.BookmarkData.ID),
+			Private: illust.BookmarkData.Private,
+		}
+	}
+	return artwork
+}
+
+// Write writes v as indented json to path
+func Write(path string, v interface{}) (err error) {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal metadata: %+v", err)
+	}
+	err = common.SaveFile(path, buf)
+	if err != nil {
+		return fmt.Errorf("failed to write metadata to \"%s\": %+v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metadata
+
+import (
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+)
+
+// Series is the series a novel is a chapter of
+type Series struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Order int    `json:"order"`
+}
+
+// Novel is the sidecar written next to the text of a novel
+type Novel struct {
+	ID             string    `json:"id"`
+	Title          string    `json:"title"`
+	Caption        string    `json:"caption"`
+	Author         Artist    `json:"author"`
+	Tags           []Tag     `json:"tags"`
+	Series         *Series   `json:"series,omitempty"`
+	CreateDate     string    `json:"createDate"`
+	UploadDate     string    `json:"uploadDate"`
+	Language       string    `json:"language"`
+	CharacterCount int       `json:"characterCount"`
+	R18            bool      `json:"r18"`
+	R18G           bool      `json:"r18g"`
+	Ai             bool      `json:"ai"`
+	Bookmark       *Bookmark `json:"bookmark,omitempty"`
+	//public or private, when it was found through the bookmarks
+	BookmarkList string `json:"bookmarkList,omitempty"`
+	CoverUrl     string `json:"coverUrl,omitempty"`
+	SourceUrl    string `json:"sourceUrl"`
+}
+
+// NewNovel builds the sidecar from the novel detail
+func NewNovel(novel api.Novel, sourceUrl string) Novel {
+	n := Novel{
+		ID:      string(novel.ID),
+		Title:   novel.Title,
+		Caption: novel.Description,
+		Author: Artist{
+			ID:   string(novel.UserID),
+			Name: novel.UserName,
+		},
+		Tags:           []Tag{},
+		CreateDate:     novel.CreateDate,
+		UploadDate:     novel.UploadDate,
+		Language:       novel.Language,
+		CharacterCount: novel.CharacterCount,
+		R18:            novel.XRestrict == api.XRestrictR18,
+		R18G:           novel.XRestrict == api.XRestrictR18G,
+		Ai:             novel.AiType == api.AiTypeAi,
+		CoverUrl:       novel.CoverUrl,
+		SourceUrl:      sourceUrl,
+	}
+	for _, tag := range novel.Tags.Tags {
+		n.Tags = append(n.Tags, Tag{Name: tag.Tag, Translations: tag.Translation})
+	}
+	if novel.SeriesNavData != nil {
+		n.Series = &Series{
+			ID:    string(novel.SeriesNavData.SeriesID),
+			Title: novel.SeriesNavData.Title,
+			Order: novel.SeriesNavData.Order,
+		}
+	}
+	if novel.BookmarkData != nil {
+		n.Bookmark = &Bookmark{
+			ID:      string(novel.BookmarkData.ID),
+			Private: novel.BookmarkData.Private,
+		}
+	}
+	return n
+}
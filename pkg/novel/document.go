@@ -0,0 +1,166 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package novel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+)
+
+// Document is a novel with what is shown above its text
+type Document struct {
+	ID          string
+	Title       string
+	Author      string
+	AuthorUrl   string
+	SeriesTitle string //empty when the novel is not part of a series
+	SeriesUrl   string
+	SeriesOrder int
+	Tags        []string
+	Language    string
+	SourceUrl   string
+	Content     string //in pixiv's novel markup
+}
+
+// Markdown renders the novel as Markdown below a title block
+func Markdown(doc Document) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", escapeMarkdown(doc.Title))
+	var lines []string
+	lines = append(lines, fmt.Sprintf("Author: [%s](%s)", escapeMarkdown(doc.Author), doc.AuthorUrl))
+	if doc.SeriesTitle != "" {
+		lines = append(lines, fmt.Sprintf("Series: [%s](%s) #%d", escapeMarkdown(doc.SeriesTitle), doc.SeriesUrl, doc.SeriesOrder))
+	}
+	if len(doc.Tags) > 0 {
+		lines = append(lines, "Tags: "+escapeMarkdown(strings.Join(doc.Tags, ", ")))
+	}
+	lines = append(lines, fmt.Sprintf("Source: <%s>", doc.SourceUrl))
+	b.WriteString(strings.Join(lines, "  \n"))
+	b.WriteString("\n\n---\n\n")
+	b.WriteString(tidyBlankLines(render(tokenize(doc.Content), markdownRenderer{})))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Text renders the novel as plain text below a title block
+func Text(doc Document) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", doc.Title)
+	fmt.Fprintf(&b, "Author: %s\n", doc.Author)
+	if doc.SeriesTitle != "" {
+		fmt.Fprintf(&b, "Series: %s #%d\n", doc.SeriesTitle, doc.SeriesOrder)
+	}
+	if len(doc.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(doc.Tags, ", "))
+	}
+	fmt.Fprintf(&b, "Source: %s\n\n", doc.SourceUrl)
+	b.WriteString(tidyBlankLines(render(tokenize(doc.Content), textRenderer{})))
+	b.WriteString("\n")
+	return b.String()
+}
+
+var blankLinesRe = regexp.MustCompile(`\n[ \t]*(\n[ \t]*)+\n`)
+
+// tidyBlankLines squeezes the blank lines left around chapters and page breaks into one
+func tidyBlankLines(str string) string {
+	return blankLinesRe.ReplaceAllString(strings.TrimSpace(str), "\n\n")
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `#`, `\#`, `<`, `\<`, `>`, `\>`)
+
+func escapeMarkdown(str string) string {
+	return markdownEscaper.Replace(str)
+}
+
+type markdownRenderer struct{}
+
+// text keeps the line breaks of the novel, which Markdown would otherwise join
+func (markdownRenderer) text(str string) string {
+	return strings.ReplaceAll(escapeMarkdown(str), "\n", "  \n")
+}
+
+func (markdownRenderer) newPage() string {
+	return "\n\n---\n\n"
+}
+
+func (markdownRenderer) chapter(title string) string {
+	return fmt.Sprintf("\n\n## %s\n\n", escapeMarkdown(title))
+}
+
+func (markdownRenderer) ruby(base, ruby string) string {
+	return fmt.Sprintf("<ruby>%s<rt>%s</rt></ruby>", escapeMarkdown(base), escapeMarkdown(ruby))
+}
+
+func (markdownRenderer) link(text, url string) string {
+	return fmt.Sprintf("[%s](<%s>)", escapeMarkdown(text), url)
+}
+
+func (markdownRenderer) pixivImage(artworkID, page string) string {
+	return fmt.Sprintf("[pixiv artwork %s](%s)", artworkID, fmt.Sprintf(config.ArtworkUrlFormat, artworkID))
+}
+
+func (markdownRenderer) uploadedImage(imageID string) string {
+	return fmt.Sprintf("(image %s)", imageID)
+}
+
+func (markdownRenderer) jump(page string) string {
+	return fmt.Sprintf("(see page %s)", page)
+}
+
+type textRenderer struct{}
+
+func (textRenderer) text(str string) string {
+	return str
+}
+
+func (textRenderer) newPage() string {
+	return "\n\n* * *\n\n"
+}
+
+func (textRenderer) chapter(title string) string {
+	return fmt.Sprintf("\n\n%s\n\n", title)
+}
+
+func (textRenderer) ruby(base, ruby string) string {
+	return fmt.Sprintf("%s(%s)", base, ruby)
+}
+
+func (textRenderer) link(text, url string) string {
+	return fmt.Sprintf("%s <%s>", text, url)
+}
+
+func (textRenderer) pixivImage(artworkID, page string) string {
+	return fmt.Sprintf("(pixiv artwork %s)", fmt.Sprintf(config.ArtworkUrlFormat, artworkID))
+}
+
+func (textRenderer) uploadedImage(imageID string) string {
+	return fmt.Sprintf("(image %s)", imageID)
+}
+
+func (textRenderer) jump(page string) string {
+	return fmt.Sprintf("(see page %s)", page)
+}
@@ -0,0 +1,296 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package novel
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+)
+
+const (
+	epubMimeType     = `application/epub+zip`
+	xhtmlMediaType   = `application/xhtml+xml`
+	defaultLanguage  = `ja`
+	hrMarker         = "\x00hr\x00" //stands for a page break until the lines are wrapped in paragraphs
+	containerXmlPath = `META-INF/container.xml`
+	containerXml     = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+)
+
+var coverExts = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Cover is the cover image of an EPUB
+type Cover struct {
+	Data     []byte
+	MimeType string //image/jpeg, image/png or image/gif
+}
+
+type epubFile struct {
+	name    string
+	content []byte
+}
+
+// section is a chapter of the book, or the text before the first chapter
+type section struct {
+	title  string
+	tokens []token
+}
+
+// splitSections starts a new section at every chapter tag. Text before the first chapter is
+// titled after the book and dropped when blank.
+func splitSections(title string, tokens []token) (sections []section) {
+	current := section{title: title}
+	for _, t := range tokens {
+		if t.kind == tokenChapter {
+			sections = append(sections, current)
+			current = section{title: t.args[0]}
+			continue
+		}
+		current.tokens = append(current.tokens, t)
+	}
+	sections = append(sections, current)
+	if len(sections) > 1 && isBlank(sections[0].tokens) {
+		sections = sections[1:]
+	}
+	return sections
+}
+
+func isBlank(tokens []token) bool {
+	for _, t := range tokens {
+		if t.kind != tokenText || strings.TrimSpace(t.args[0]) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteEpub writes the novel to w as an EPUB 3 book. cover can be nil.
+func WriteEpub(w io.Writer, doc Document, cover *Cover, modified time.Time) (err error) {
+	lang := doc.Language
+	if lang == "" {
+		lang = defaultLanguage
+	}
+	sections := splitSections(doc.Title, tokenize(doc.Content))
+
+	z := zip.NewWriter(w)
+	//the mimetype has to be the first entry and stored uncompressed
+	mimeWriter, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("unable to add mimetype to epub: %+v", err)
+	}
+	_, err = io.WriteString(mimeWriter, epubMimeType)
+	if err != nil {
+		return fmt.Errorf("unable to write mimetype to epub: %+v", err)
+	}
+
+	files := []epubFile{
+		{containerXmlPath, []byte(containerXml)},
+		{"OEBPS/content.opf", []byte(packageDocument(doc, lang, sections, cover, modified))},
+		{"OEBPS/nav.xhtml", []byte(navDocument(doc, lang, sections))},
+	}
+	if cover != nil {
+		ext := coverExts[cover.MimeType]
+		if ext == "" {
+			return fmt.Errorf("unsupported cover image type \"%s\"", cover.MimeType)
+		}
+		files = append(files,
+			epubFile{"OEBPS/cover." + ext, cover.Data},
+			epubFile{"OEBPS/cover.xhtml", []byte(coverDocument(doc, lang, "cover."+ext))},
+		)
+	}
+	for i, s := range sections {
+		files = append(files, epubFile{"OEBPS/" + sectionFileName(i), []byte(sectionDocument(lang, s))})
+	}
+
+	for _, f := range files {
+		fw, err := z.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return fmt.Errorf("unable to add %s to epub: %+v", f.name, err)
+		}
+		_, err = fw.Write(f.content)
+		if err != nil {
+			return fmt.Errorf("unable to write %s to epub: %+v", f.name, err)
+		}
+	}
+	err = z.Close()
+	if err != nil {
+		return fmt.Errorf("unable to finish epub: %+v", err)
+	}
+	return nil
+}
+
+func sectionFileName(i int) string {
+	return fmt.Sprintf("section-%d.xhtml", i+1)
+}
+
+func xhtmlHeader(lang, title string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%[1]s" lang="%[1]s">
+<head>
+  <meta charset="UTF-8"/>
+  <title>%[2]s</title>
+</head>
+<body>
+`, html.EscapeString(lang), html.EscapeString(title))
+}
+
+const xhtmlFooter = `</body>
+</html>
+`
+
+func packageDocument(doc Document, lang string, sections []section, cover *Cover, modified time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="%s">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">urn:pixiv:novel:%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:creator>%s</dc:creator>
+    <dc:language>%s</dc:language>
+    <dc:source>%s</dc:source>
+    <meta property="dcterms:modified">%s</meta>
+`, html.EscapeString(lang), html.EscapeString(doc.ID), html.EscapeString(doc.Title), html.EscapeString(doc.Author),
+		html.EscapeString(lang), html.EscapeString(doc.SourceUrl), modified.UTC().Format("2006-01-02T15:04:05Z"))
+	for _, tag := range doc.Tags {
+		fmt.Fprintf(&b, "    <dc:subject>%s</dc:subject>\n", html.EscapeString(tag))
+	}
+	if doc.SeriesTitle != "" {
+		fmt.Fprintf(&b, "    <meta property=\"belongs-to-collection\" id=\"series\">%s</meta>\n", html.EscapeString(doc.SeriesTitle))
+		fmt.Fprintf(&b, "    <meta refines=\"#series\" property=\"collection-type\">series</meta>\n")
+		fmt.Fprintf(&b, "    <meta refines=\"#series\" property=\"group-position\">%d</meta>\n", doc.SeriesOrder)
+	}
+	if cover != nil {
+		b.WriteString("    <meta name=\"cover\" content=\"cover-image\"/>\n")
+	}
+	b.WriteString("  </metadata>\n  <manifest>\n")
+	fmt.Fprintf(&b, "    <item id=\"nav\" href=\"nav.xhtml\" media-type=\"%s\" properties=\"nav\"/>\n", xhtmlMediaType)
+	if cover != nil {
+		fmt.Fprintf(&b, "    <item id=\"cover-image\" href=\"cover.%s\" media-type=\"%s\" properties=\"cover-image\"/>\n", coverExts[cover.MimeType], cover.MimeType)
+		fmt.Fprintf(&b, "    <item id=\"cover\" href=\"cover.xhtml\" media-type=\"%s\"/>\n", xhtmlMediaType)
+	}
+	for i := range sections {
+		fmt.Fprintf(&b, "    <item id=\"section-%d\" href=\"%s\" media-type=\"%s\"/>\n", i+1, sectionFileName(i), xhtmlMediaType)
+	}
+	b.WriteString("  </manifest>\n  <spine>\n")
+	if cover != nil {
+		b.WriteString("    <itemref idref=\"cover\" linear=\"no\"/>\n")
+	}
+	for i := range sections {
+		fmt.Fprintf(&b, "    <itemref idref=\"section-%d\"/>\n", i+1)
+	}
+	b.WriteString("  </spine>\n</package>\n")
+	return b.String()
+}
+
+func navDocument(doc Document, lang string, sections []section) string {
+	var b strings.Builder
+	b.WriteString(xhtmlHeader(lang, doc.Title))
+	b.WriteString("  <nav epub:type=\"toc\" id=\"toc\">\n    <ol>\n")
+	for i, s := range sections {
+		fmt.Fprintf(&b, "      <li><a href=\"%s\">%s</a></li>\n", sectionFileName(i), html.EscapeString(s.title))
+	}
+	b.WriteString("    </ol>\n  </nav>\n")
+	b.WriteString(xhtmlFooter)
+	return b.String()
+}
+
+func coverDocument(doc Document, lang string, href string) string {
+	return xhtmlHeader(lang, doc.Title) +
+		fmt.Sprintf("  <div epub:type=\"cover\"><img src=\"%s\" alt=\"%s\"/></div>\n", href, html.EscapeString(doc.Title)) +
+		xhtmlFooter
+}
+
+// sectionDocument renders a section with every line of the novel as a paragraph
+func sectionDocument(lang string, s section) string {
+	var b strings.Builder
+	b.WriteString(xhtmlHeader(lang, s.title))
+	fmt.Fprintf(&b, "  <h2>%s</h2>\n", html.EscapeString(s.title))
+	body := render(s.tokens, xhtmlRenderer{})
+	//the line breaks around a page break are part of it
+	body = strings.ReplaceAll(body, "\n\n"+hrMarker, "\n"+hrMarker)
+	body = strings.ReplaceAll(body, hrMarker+"\n\n", hrMarker+"\n")
+	body = strings.Trim(body, "\n")
+	for _, line := range strings.Split(body, "\n") {
+		switch {
+		case line == hrMarker:
+			b.WriteString("  <hr/>\n")
+		case strings.TrimSpace(line) == "":
+			b.WriteString("  <p><br/></p>\n")
+		default:
+			fmt.Fprintf(&b, "  <p>%s</p>\n", line)
+		}
+	}
+	b.WriteString(xhtmlFooter)
+	return b.String()
+}
+
+type xhtmlRenderer struct{}
+
+func (xhtmlRenderer) text(str string) string {
+	return html.EscapeString(str)
+}
+
+func (xhtmlRenderer) newPage() string {
+	return "\n" + hrMarker + "\n"
+}
+
+// chapter never happens as the sections are split at chapters
+func (xhtmlRenderer) chapter(title string) string {
+	return ""
+}
+
+func (xhtmlRenderer) ruby(base, ruby string) string {
+	return fmt.Sprintf("<ruby>%s<rt>%s</rt></ruby>", html.EscapeString(base), html.EscapeString(ruby))
+}
+
+func (xhtmlRenderer) link(text, url string) string {
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(url), html.EscapeString(text))
+}
+
+func (xhtmlRenderer) pixivImage(artworkID, page string) string {
+	return xhtmlRenderer{}.link("pixiv artwork "+artworkID, fmt.Sprintf(config.ArtworkUrlFormat, artworkID))
+}
+
+func (xhtmlRenderer) uploadedImage(imageID string) string {
+	return html.EscapeString(fmt.Sprintf("(image %s)", imageID))
+}
+
+func (xhtmlRenderer) jump(page string) string {
+	return html.EscapeString(fmt.Sprintf("(see page %s)", page))
+}
@@ -0,0 +1,161 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package novel
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type opfPackage struct {
+	Manifest []struct {
+		ID   string `xml:"id,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef  string `xml:"idref,attr"`
+		Linear string `xml:"linear,attr"`
+	} `xml:"spine>itemref"`
+}
+
+type navDoc struct {
+	Links []struct {
+		Href string `xml:"href,attr"`
+	} `xml:"body>nav>ol>li>a"`
+}
+
+func readZipFile(t *testing.T, files map[string]*zip.File, name string) []byte {
+	f, ok := files[name]
+	if !ok {
+		t.Fatalf("epub has no %s", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		t.Fatalf("Open(%s) error = %+v", name, err)
+	}
+	defer r.Close()
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll(%s) error = %+v", name, err)
+	}
+	return buf
+}
+
+func TestWriteEpub(t *testing.T) {
+	doc := Document{
+		ID:      "1",
+		Title:   "Title",
+		Author:  "Author",
+		Content: "preface[chapter:One]first[newpage]page[chapter:Two & more]second",
+	}
+	cover := &Cover{Data: []byte("not checked"), MimeType: "image/png"}
+	var buf bytes.Buffer
+	err := WriteEpub(&buf, doc, cover, time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("WriteEpub() error = %+v", err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewReader() error = %+v", err)
+	}
+
+	first := z.File[0]
+	if first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("first entry = %s with method %d, want mimetype stored uncompressed", first.Name, first.Method)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+	if got := string(readZipFile(t, files, "mimetype")); got != epubMimeType {
+		t.Errorf("mimetype = %q, want %q", got, epubMimeType)
+	}
+	readZipFile(t, files, containerXmlPath)
+
+	var opf opfPackage
+	err = xml.Unmarshal(readZipFile(t, files, "OEBPS/content.opf"), &opf)
+	if err != nil {
+		t.Fatalf("Unmarshal(content.opf) error = %+v", err)
+	}
+	hrefs := map[string]string{}
+	for _, item := range opf.Manifest {
+		hrefs[item.ID] = item.Href
+		if _, ok := files[path.Join("OEBPS", item.Href)]; !ok {
+			t.Errorf("manifest item %s points to missing %s", item.ID, item.Href)
+		}
+	}
+	var spine []string
+	for _, ref := range opf.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			t.Errorf("spine refers to %s, which is not in the manifest", ref.IDRef)
+		}
+		if ref.Linear != "no" {
+			spine = append(spine, href)
+		}
+	}
+
+	var nav navDoc
+	err = xml.Unmarshal(readZipFile(t, files, "OEBPS/nav.xhtml"), &nav)
+	if err != nil {
+		t.Fatalf("Unmarshal(nav.xhtml) error = %+v", err)
+	}
+	var toc []string
+	for _, link := range nav.Links {
+		toc = append(toc, link.Href)
+	}
+	if !reflect.DeepEqual(toc, spine) {
+		t.Errorf("nav entries = %v, want the spine %v", toc, spine)
+	}
+	if len(toc) != 3 {
+		t.Errorf("got %d sections, want the preface and two chapters", len(toc))
+	}
+}
+
+func TestSplitSections(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"no chapters", "text", []string{"Book"}},
+		{"blank preface is dropped", "\n[chapter:One]a[chapter:Two]b", []string{"One", "Two"}},
+		{"preface is kept", "intro[chapter:One]a", []string{"Book", "One"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range splitSections("Book", tokenize(tt.content)) {
+				got = append(got, s.title)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSections(%q) titles = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
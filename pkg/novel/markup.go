@@ -0,0 +1,126 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package novel
+
+import (
+	"regexp"
+	"strings"
+)
+
+// the tags of pixiv's novel markup
+var tagRe = regexp.MustCompile(`\[newpage\]|\[chapter:([^\]\n]*)\]|\[\[rb:(.*?) > (.*?)\]\]|\[\[jumpuri:(.*?) > (.*?)\]\]|\[pixivimage:(\d+)(?:-(\d+))?\]|\[uploadedimage:(\d+)\]|\[jump:(\d+)\]`)
+
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenNewPage
+	tokenChapter
+	tokenRuby
+	tokenLink
+	tokenPixivImage
+	tokenUploadedImage
+	tokenJump
+)
+
+// token is a run of text or a tag of the markup with its arguments
+type token struct {
+	kind tokenKind
+	args []string
+}
+
+// tokenize splits content into text and tags. Unknown tags are left in the text.
+func tokenize(content string) (tokens []token) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	last := 0
+	for _, m := range tagRe.FindAllStringSubmatchIndex(content, -1) {
+		if m[0] > last {
+			tokens = append(tokens, token{kind: tokenText, args: []string{content[last:m[0]]}})
+		}
+		group := func(i int) string {
+			if m[2*i] < 0 {
+				return ""
+			}
+			return content[m[2*i]:m[2*i+1]]
+		}
+		tag := content[m[0]:m[1]]
+		switch {
+		case tag == "[newpage]":
+			tokens = append(tokens, token{kind: tokenNewPage})
+		case strings.HasPrefix(tag, "[chapter:"):
+			tokens = append(tokens, token{kind: tokenChapter, args: []string{strings.TrimSpace(group(1))}})
+		case strings.HasPrefix(tag, "[[rb:"):
+			tokens = append(tokens, token{kind: tokenRuby, args: []string{group(2), group(3)}})
+		case strings.HasPrefix(tag, "[[jumpuri:"):
+			tokens = append(tokens, token{kind: tokenLink, args: []string{group(4), group(5)}})
+		case strings.HasPrefix(tag, "[pixivimage:"):
+			tokens = append(tokens, token{kind: tokenPixivImage, args: []string{group(6), group(7)}})
+		case strings.HasPrefix(tag, "[uploadedimage:"):
+			tokens = append(tokens, token{kind: tokenUploadedImage, args: []string{group(8)}})
+		case strings.HasPrefix(tag, "[jump:"):
+			tokens = append(tokens, token{kind: tokenJump, args: []string{group(9)}})
+		}
+		last = m[1]
+	}
+	if last < len(content) {
+		tokens = append(tokens, token{kind: tokenText, args: []string{content[last:]}})
+	}
+	return tokens
+}
+
+// renderer turns every kind of token into an output format
+type renderer interface {
+	text(str string) string
+	newPage() string
+	chapter(title string) string
+	ruby(base, ruby string) string
+	link(text, url string) string
+	pixivImage(artworkID, page string) string
+	uploadedImage(imageID string) string
+	jump(page string) string
+}
+
+func render(tokens []token, r renderer) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenText:
+			b.WriteString(r.text(t.args[0]))
+		case tokenNewPage:
+			b.WriteString(r.newPage())
+		case tokenChapter:
+			b.WriteString(r.chapter(t.args[0]))
+		case tokenRuby:
+			b.WriteString(r.ruby(t.args[0], t.args[1]))
+		case tokenLink:
+			b.WriteString(r.link(t.args[0], t.args[1]))
+		case tokenPixivImage:
+			b.WriteString(r.pixivImage(t.args[0], t.args[1]))
+		case tokenUploadedImage:
+			b.WriteString(r.uploadedImage(t.args[0]))
+		case tokenJump:
+			b.WriteString(r.jump(t.args[0]))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,105 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package novel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []token
+	}{
+		{"plain text", "hello", []token{{tokenText, []string{"hello"}}}},
+		{"empty", "", nil},
+		{"newpage", "a[newpage]b", []token{
+			{tokenText, []string{"a"}}, {tokenNewPage, nil}, {tokenText, []string{"b"}}}},
+		{"chapter title is trimmed", "[chapter: One ]text", []token{
+			{tokenChapter, []string{"One"}}, {tokenText, []string{"text"}}}},
+		{"empty chapter", "[chapter:]", []token{{tokenChapter, []string{""}}}},
+		{"ruby", "[[rb:漢字 > かんじ]]", []token{{tokenRuby, []string{"漢字", "かんじ"}}}},
+		{"link", "[[jumpuri:pixiv > https://www.pixiv.net]]", []token{
+			{tokenLink, []string{"pixiv", "https://www.pixiv.net"}}}},
+		{"pixivimage", "[pixivimage:123]", []token{{tokenPixivImage, []string{"123", ""}}}},
+		{"pixivimage with page", "[pixivimage:123-2]", []token{{tokenPixivImage, []string{"123", "2"}}}},
+		{"uploadedimage", "[uploadedimage:45]", []token{{tokenUploadedImage, []string{"45"}}}},
+		{"jump", "[jump:3]", []token{{tokenJump, []string{"3"}}}},
+		{"crlf", "a\r\nb", []token{{tokenText, []string{"a\nb"}}}},
+		{"unterminated chapter", "[chapter:One", []token{{tokenText, []string{"[chapter:One"}}}},
+		{"chapter across lines", "[chapter:a\nb]", []token{{tokenText, []string{"[chapter:a\nb]"}}}},
+		{"unterminated newpage", "[newpage", []token{{tokenText, []string{"[newpage"}}}},
+		{"ruby without separator", "[[rb:漢字]]", []token{{tokenText, []string{"[[rb:漢字]]"}}}},
+		{"unterminated link", "[[jumpuri:a > b", []token{{tokenText, []string{"[[jumpuri:a > b"}}}},
+		{"pixivimage without id", "[pixivimage:abc]", []token{{tokenText, []string{"[pixivimage:abc]"}}}},
+		{"unknown tag", "[foo:1]", []token{{tokenText, []string{"[foo:1]"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tokenize(tt.content)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenize(%q) = %+v, want %+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		text     string
+		markdown string
+		xhtml    string
+	}{
+		{"newpage", "a[newpage]b", "a\n\n* * *\n\nb", "a\n\n---\n\nb", "a\n" + hrMarker + "\nb"},
+		{"chapter", "[chapter:One]", "\n\nOne\n\n", "\n\n## One\n\n", ""},
+		{"ruby", "[[rb:漢字 > かんじ]]", "漢字(かんじ)", "<ruby>漢字<rt>かんじ</rt></ruby>", "<ruby>漢字<rt>かんじ</rt></ruby>"},
+		{"link", "[[jumpuri:a&b > https://example.com/?a=1&b=2]]",
+			"a&b <https://example.com/?a=1&b=2>",
+			"[a&b](<https://example.com/?a=1&b=2>)",
+			`<a href="https://example.com/?a=1&amp;b=2">a&amp;b</a>`},
+		{"pixivimage", "[pixivimage:123-2]",
+			"(pixiv artwork https://www.pixiv.net/artworks/123)",
+			"[pixiv artwork 123](https://www.pixiv.net/artworks/123)",
+			`<a href="https://www.pixiv.net/artworks/123">pixiv artwork 123</a>`},
+		{"markup in text is escaped", "<b>*x*</b>", "<b>*x*</b>", `\<b\>\*x\*\</b\>`, "&lt;b&gt;*x*&lt;/b&gt;"},
+		{"line breaks", "a\nb", "a\nb", "a  \nb", "a\nb"},
+		{"unterminated tag is text", "[[rb:a", "[[rb:a", `\[\[rb:a`, "[[rb:a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := tokenize(tt.content)
+			if got := render(tokens, textRenderer{}); got != tt.text {
+				t.Errorf("render(%q, text) = %q, want %q", tt.content, got, tt.text)
+			}
+			if got := render(tokens, markdownRenderer{}); got != tt.markdown {
+				t.Errorf("render(%q, markdown) = %q, want %q", tt.content, got, tt.markdown)
+			}
+			if got := render(tokens, xhtmlRenderer{}); got != tt.xhtml {
+				t.Errorf("render(%q, xhtml) = %q, want %q", tt.content, got, tt.xhtml)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package paths
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	//most filesystems limit a file name to 255 bytes. Leave room for suffixes such as ".part".
+	maxComponentBytes = 200
+	replacementChar   = '_'
+)
+
+var (
+	//names windows refuses for files, with or without an extension
+	reservedNames = map[string]struct{}{
+		"CON": {}, "PRN": {}, "AUX": {}, "NUL": {},
+		"COM1": {}, "COM2": {}, "COM3": {}, "COM4": {}, "COM5": {}, "COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+		"LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {}, "LPT5": {}, "LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+	}
+)
+
+func isIllegal(r rune) bool {
+	switch r {
+	case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+		return true
+	}
+	return unicode.IsControl(r)
+}
+
+// SanitizeComponent makes str safe to be a single file or directory name:
+// it is NFC normalized, illegal characters are replaced, and it is never empty, "." or ".."
+func SanitizeComponent(str string) string {
+	str = norm.NFC.String(str)
+	str = strings.Map(func(r rune) rune {
+		if isIllegal(r) {
+			return replacementChar
+		}
+		return r
+	}, str)
+	str = strings.TrimSpace(str)
+	//windows drops trailing dots and spaces
+	str = strings.TrimRight(str, ". ")
+
+	if str == "" {
+		return string(replacementChar)
+	}
+	base := strings.ToUpper(strings.SplitN(str, ".", 2)[0])
+	if _, reserved := reservedNames[base]; reserved {
+		str = string(replacementChar) + str
+	}
+	return truncateComponent(str)
+}
+
+// truncateComponent cuts str to maxComponentBytes without splitting a character.
+// The extension is kept when there is one.
+func truncateComponent(str string) string {
+	if len(str) <= maxComponentBytes {
+		return str
+	}
+	ext := ""
+	if dot := strings.LastIndexByte(str, '.'); dot > 0 && len(str)-dot <= 10 {
+		ext = str[dot:]
+		str = str[:dot]
+	}
+	limit := maxComponentBytes - len(ext)
+	for limit > 0 && !utf8.RuneStart(str[limit]) {
+		limit--
+	}
+	return str[:limit] + ext
+}
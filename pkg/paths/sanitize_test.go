@@ -0,0 +1,92 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package paths
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeComponent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "title", "title"},
+		{"illegal characters", `a/b\c:d*e?f"g<h>i|j`, "a_b_c_d_e_f_g_h_i_j"},
+		{"control characters", "a\x00b\tc", "a_b_c"},
+		{"nfc", "e\u0301", "\u00e9"},
+		{"surrounding spaces", "  title  ", "title"},
+		{"trailing dots and spaces", "title. . ", "title"},
+		{"empty", "", "_"},
+		{"only spaces", "   ", "_"},
+		{"dot", ".", "_"},
+		{"dot dot", "..", "_"},
+		{"reserved name", "CON", "_CON"},
+		{"reserved name in lower case", "nul", "_nul"},
+		{"reserved name with extension", "com1.jpg", "_com1.jpg"},
+		{"not a reserved name", "CONSOLE", "CONSOLE"},
+		{"path traversal", "../../etc", ".._.._etc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeComponent(tt.in); got != tt.want {
+				t.Errorf("SanitizeComponent(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateComponent(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantLen int
+		wantExt string
+	}{
+		{"short", "title.jpg", len("title.jpg"), ".jpg"},
+		{"at the limit", strings.Repeat("a", maxComponentBytes), maxComponentBytes, ""},
+		{"ascii over the limit", strings.Repeat("a", 300), maxComponentBytes, ""},
+		{"ascii with extension", strings.Repeat("a", 300) + ".png", maxComponentBytes, ".png"},
+		//3 byte characters, the limit falls in the middle of one
+		{"multibyte", strings.Repeat("あ", 100), 198, ""},
+		{"multibyte with extension", strings.Repeat("あ", 100) + ".jpg", 199, ".jpg"},
+		//a long "extension" is just part of the name
+		{"long extension", strings.Repeat("a", 150) + "." + strings.Repeat("b", 150), maxComponentBytes, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateComponent(tt.in)
+			if len(got) != tt.wantLen {
+				t.Errorf("truncateComponent() is %d bytes, want %d", len(got), tt.wantLen)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateComponent() = %q, not valid utf-8", got)
+			}
+			if tt.wantExt != "" && !strings.HasSuffix(got, tt.wantExt) {
+				t.Errorf("truncateComponent() = %q, lost extension %q", got, tt.wantExt)
+			}
+		})
+	}
+}
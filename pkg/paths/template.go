@@ -0,0 +1,194 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	dirPermission = 0755
+)
+
+// the variables a template can use
+const (
+	VarArtworkID  = `artwork_id`
+	VarArtistID   = `artist_id`
+	VarArtistName = `artist_name`
+	VarTitle      = `title`
+	VarPage       = `page`
+	VarExt        = `ext`
+	VarFilename   = `filename`
+	//the bookmark tag the artwork was listed under, empty when BookmarkTags is unset
+	VarBookmarkTag = `bookmark_tag`
+)
+
+var (
+	knownVars = map[string]struct{}{
+		VarArtworkID:   {},
+		VarArtistID:    {},
+		VarArtistName:  {},
+		VarTitle:       {},
+		VarPage:        {},
+		VarExt:         {},
+		VarFilename:    {},
+		VarBookmarkTag: {},
+	}
+)
+
+// Values are what the variables of a template are replaced with. Values are either strings or ints.
+type Values map[string]interface{}
+
+type segment struct {
+	literal string
+	varName string
+	width   int //zero padding of ints, e.g. 2 for {page:02}
+}
+
+// Template is a path such as "{artist_id}_{artist_name}/{artwork_id}_{title}/p{page:02}.{ext}".
+// "/" separates directories on every platform.
+type Template struct {
+	raw      string
+	segments []segment
+}
+
+// Parse parses a template and checks that it only uses known variables
+func Parse(raw string) (t Template, err error) {
+	t.raw = raw
+	rest := raw
+	for len(rest) > 0 {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.segments = append(t.segments, segment{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.segments = append(t.segments, segment{literal: rest[:open]})
+		}
+		close := strings.IndexByte(rest[open:], '}')
+		if close < 0 {
+			return t, fmt.Errorf("unclosed \"{\" in path template \"%s\"", raw)
+		}
+		seg, err := parseVar(rest[open+1 : open+close])
+		if err != nil {
+			return t, fmt.Errorf("invalid path template \"%s\": %+v", raw, err)
+		}
+		t.segments = append(t.segments, seg)
+		rest = rest[open+close+1:]
+	}
+	if len(t.segments) <= 0 {
+		return t, fmt.Errorf("empty path template")
+	}
+	return t, nil
+}
+
+func parseVar(str string) (seg segment, err error) {
+	parts := strings.SplitN(str, ":", 2)
+	seg.varName = parts[0]
+	if _, ok := knownVars[seg.varName]; !ok {
+		return seg, fmt.Errorf("unknown variable \"%s\"", seg.varName)
+	}
+	if len(parts) > 1 {
+		seg.width, err = strconv.Atoi(parts[1])
+		if err != nil || seg.width < 0 {
+			return seg, fmt.Errorf("invalid width \"%s\" of variable \"%s\"", parts[1], seg.varName)
+		}
+	}
+	return seg, nil
+}
+
+// Uses tells if the template has the variable
+func (t Template) Uses(varName string) bool {
+	for _, seg := range t.segments {
+		if seg.varName == varName {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Template) String() string {
+	return t.raw
+}
+
+// Render replaces the variables with values and returns a sanitized path under root
+func (t Template) Render(root string, values Values) (path string, err error) {
+	var b strings.Builder
+	for _, seg := range t.segments {
+		if seg.varName == "" {
+			b.WriteString(seg.literal)
+			continue
+		}
+		val, ok := values[seg.varName]
+		if !ok {
+			return path, fmt.Errorf("no value for variable \"%s\" of path template \"%s\"", seg.varName, t.raw)
+		}
+		b.WriteString(SanitizeComponent(formatValue(val, seg.width)))
+	}
+
+	var components []string
+	for _, component := range strings.Split(b.String(), "/") {
+		if component == "" || component == "." {
+			continue
+		}
+		if component == ".." {
+			return path, fmt.Errorf("path template \"%s\" must not leave the output directory", t.raw)
+		}
+		components = append(components, truncateComponent(component))
+	}
+	if len(components) <= 0 {
+		return path, fmt.Errorf("path template \"%s\" rendered to an empty path", t.raw)
+	}
+	return filepath.Join(append([]string{root}, components...)...), nil
+}
+
+// Create renders the path like Render and creates its directory if missing
+func (t Template) Create(root string, values Values) (path string, err error) {
+	path, err = t.Render(root, values)
+	if err != nil {
+		return path, err
+	}
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, dirPermission)
+	if err != nil {
+		return path, fmt.Errorf("unable to create directory \"%s\": %+v", dir, err)
+	}
+	return path, nil
+}
+
+func formatValue(val interface{}, width int) string {
+	switch v := val.(type) {
+	case int:
+		return fmt.Sprintf("%0*d", width, v)
+	case string:
+		//numeric strings such as IDs are padded as well
+		if n, err := strconv.Atoi(v); err == nil && width > 0 {
+			return fmt.Sprintf("%0*d", width, n)
+		}
+		return v
+	}
+	return fmt.Sprint(val)
+}
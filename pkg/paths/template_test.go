@@ -0,0 +1,121 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package paths
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"default", "{artist_id}_{artist_name}/{artwork_id}_{title}/p{page:02}.{ext}", false},
+		{"literal only", "artworks", false},
+		{"unknown variable", "{artwork_id}_{unknown}", true},
+		{"unclosed", "{artwork_id", true},
+		{"invalid width", "{page:x}", true},
+		{"negative width", "{page:-1}", true},
+		{"empty", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse(%q) error = %+v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	values := Values{
+		VarArtworkID:  "12345",
+		VarArtistID:   "678",
+		VarArtistName: "name/with:slash",
+		VarTitle:      "CON",
+		VarPage:       3,
+		VarExt:        "png",
+	}
+	tests := []struct {
+		name    string
+		raw     string
+		values  Values
+		want    string
+		wantErr bool
+	}{
+		{"default", "{artist_id}_{artist_name}/{artwork_id}_{title}/p{page:02}.{ext}", values,
+			"678_name_with_slash/12345__CON/p03.png", false},
+		{"padded id", "{artwork_id:08}.{ext}", values, "00012345.png", false},
+		{"empty components are dropped", "a//./{artwork_id}.{ext}", values, "a/12345.png", false},
+		{"values cannot leave the root", "{title}/{artwork_id}.{ext}", Values{VarTitle: "..", VarArtworkID: "1", VarExt: "png"},
+			"_/1.png", false},
+		{"values cannot add directories", "{title}.{ext}", Values{VarTitle: "../../etc/passwd", VarExt: "png"},
+			".._.._etc_passwd.png", false},
+		{"dot dot", "../{artwork_id}.{ext}", values, "", true},
+		{"missing value", "{bookmark_tag}/{artwork_id}.{ext}", values, "", true},
+		{"empty path", "/./", values, "", true},
+	}
+	root := filepath.Join("out", "saved")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %+v", tt.raw, err)
+			}
+			got, err := tmpl.Render(root, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %+v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if want := filepath.Join(root, filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("Render() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRenderTruncatesLongComponents(t *testing.T) {
+	tmpl, err := Parse("{title}/{artwork_id}_{title}.{ext}")
+	if err != nil {
+		t.Fatalf("Parse() error = %+v", err)
+	}
+	title := strings.Repeat("長", 150)
+	got, err := tmpl.Render("", Values{VarTitle: title, VarArtworkID: "1", VarExt: "jpg"})
+	if err != nil {
+		t.Fatalf("Render() error = %+v", err)
+	}
+	for _, component := range strings.Split(filepath.ToSlash(got), "/") {
+		if len(component) > maxComponentBytes {
+			t.Errorf("component %q is %d bytes, over %d", component, len(component), maxComponentBytes)
+		}
+	}
+	if !strings.HasSuffix(got, ".jpg") {
+		t.Errorf("Render() = %q, lost the extension", got)
+	}
+}
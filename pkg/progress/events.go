@@ -0,0 +1,159 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// Kind tells what an Event is about
+type Kind int
+
+const (
+	ListingPage  Kind = iota //a page of a listing was got: Page of Pages, Count items on it
+	ItemStarted              //an artwork or a novel started being processed: Index of Count on its listing page
+	ItemDone                 //an item was processed
+	ItemSkipped              //an item was left out for Reason
+	ItemFailed               //an item failed with Err
+	PageSaved                //a page of an artwork was saved at Path: ArtworkPage of ArtworkPages
+	BytesWritten             //Bytes more bytes were written to Path
+)
+
+// the reasons an item is skipped for
+const (
+	SkippedDownloaded   = "downloaded before"
+	SkippedListed       = "listed before in this run"
+	SkippedExcludedTag  = "excluded bookmark tag"
+	SkippedFewBookmarks = "too few bookmarks"
+)
+
+var kindNames = []string{"listing page", "item started", "item done", "item skipped", "item failed", "page saved", "bytes written"}
+
+func (k Kind) String() string {
+	if k < ListingPage || k > BytesWritten {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// Event is a step of a run. Only the fields that its Kind describes are set.
+type Event struct {
+	Kind Kind
+	Time time.Time
+
+	Listing string //what is being listed, such as "public bookmarks"
+	Page    int    //the page of the listing, from 1
+	Pages   int    //how many pages the listing has, 0 when unknown
+
+	ID    string //the artwork ID, or "novel/" and the novel ID
+	Index int    //where the item is on its listing page, from 1. 0 when it was not found through a listing
+	Count int    //how many items the listing page has
+
+	ArtworkPage  int //the page of the artwork, from 1
+	ArtworkPages int //how many pages the artwork has, 0 when unknown
+
+	Path   string
+	Bytes  int64
+	Reason string //why the item was skipped, one of the Skipped* reasons
+	Err    error
+}
+
+// Bus hands every emitted event to the subscribers
+type Bus struct {
+	lock        sync.Mutex
+	nextID      int
+	subscribers map[int]func(Event)
+}
+
+var (
+	// Events is where the packages of this program emit their progress
+	Events = new(Bus)
+)
+
+// Subscribe calls f on every event until unsubscribe is called.
+// f is called from the goroutine that emits, so it should return quickly.
+func (b *Bus) Subscribe(f func(Event)) (unsubscribe func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[int]func(Event))
+	}
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = f
+	return func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Channel sends every event to a channel holding up to size events until unsubscribe is called, which closes it.
+// Events that do not fit are dropped, so that a slow reader never holds up the run.
+func (b *Bus) Channel(size int) (events <-chan Event, unsubscribe func()) {
+	ch := make(chan Event, size)
+	var lock sync.Mutex
+	closed := false
+	cancel := b.Subscribe(func(ev Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	})
+	return ch, func() {
+		cancel()
+		lock.Lock()
+		defer lock.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+}
+
+// Emit stamps ev with the current time when it has none and hands it to the subscribers
+func (b *Bus) Emit(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b.lock.Lock()
+	subscribers := make([]func(Event), 0, len(b.subscribers))
+	for _, f := range b.subscribers {
+		subscribers = append(subscribers, f)
+	}
+	b.lock.Unlock()
+	for _, f := range subscribers {
+		f(ev)
+	}
+}
+
+// Emit emits ev on Events
+func Emit(ev Event) {
+	Events.Emit(ev)
+}
@@ -0,0 +1,209 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	redrawInterval = 100 * time.Millisecond
+	clearLine      = "\r\033[K"
+)
+
+// Terminal keeps a line with the progress of the run and an ETA at the bottom of a terminal
+type Terminal struct {
+	lock        sync.Mutex
+	out         io.Writer
+	unsubscribe func()
+	drawn       bool
+	lastDraw    time.Time
+
+	listing         string
+	page            int
+	pages           int
+	listingListed   int //items listed under the current listing
+	listed          int //items listed under every listing
+	firstStarted    time.Time
+	started         int
+	done            int
+	skipped         int
+	failed          int
+	bytes           int64
+	lastArtworkPage string
+}
+
+// NewTerminal draws on out, which should be a terminal
+func NewTerminal(out io.Writer) *Terminal {
+	return &Terminal{out: out}
+}
+
+// Start draws the events of bus until Stop is called
+func (t *Terminal) Start(bus *Bus) {
+	t.unsubscribe = bus.Subscribe(t.handle)
+}
+
+// Stop draws the line a last time and leaves it in place
+func (t *Terminal) Stop() {
+	if t.unsubscribe != nil {
+		t.unsubscribe()
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.drawn {
+		t.draw()
+		fmt.Fprint(t.out, "\n")
+		t.drawn = false
+	}
+}
+
+// Writer wraps w, which shares the terminal with t, so that what is written to it does not run into the progress line
+func (t *Terminal) Writer(w io.Writer) io.Writer {
+	return &terminalWriter{t: t, w: w}
+}
+
+type terminalWriter struct {
+	t *Terminal
+	w io.Writer
+}
+
+func (tw *terminalWriter) Write(buf []byte) (n int, err error) {
+	tw.t.lock.Lock()
+	defer tw.t.lock.Unlock()
+	if tw.t.drawn {
+		fmt.Fprint(tw.t.out, clearLine)
+	}
+	n, err = tw.w.Write(buf)
+	if tw.t.drawn {
+		tw.t.draw()
+	}
+	return n, err
+}
+
+func (t *Terminal) handle(ev Event) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	switch ev.Kind {
+	case ListingPage:
+		if ev.Listing != t.listing {
+			t.listing = ev.Listing
+			t.listingListed = 0
+		}
+		t.page = ev.Page
+		t.pages = ev.Pages
+		t.listingListed += ev.Count
+		t.listed += ev.Count
+	case ItemStarted:
+		if t.firstStarted.IsZero() {
+			t.firstStarted = ev.Time
+		}
+		t.started++
+	case ItemDone:
+		t.done++
+	case ItemSkipped:
+		t.skipped++
+	case ItemFailed:
+		t.failed++
+	case PageSaved:
+		if ev.ArtworkPages > 1 {
+			t.lastArtworkPage = fmt.Sprintf("artwork %s page %d/%d", ev.ID, ev.ArtworkPage, ev.ArtworkPages)
+		}
+	case BytesWritten:
+		t.bytes += ev.Bytes
+	}
+	if !t.drawn || time.Since(t.lastDraw) >= redrawInterval {
+		t.draw()
+	}
+}
+
+// draw replaces the progress line. The lock must be held.
+func (t *Terminal) draw() {
+	var parts []string
+	if t.listing != "" {
+		page := fmt.Sprintf("%s page %d", t.listing, t.page)
+		if t.pages > 0 {
+			page += fmt.Sprintf("/%d", t.pages)
+		}
+		parts = append(parts, page)
+	}
+	finished := t.done + t.skipped + t.failed
+	items := fmt.Sprintf("%d/%d items", finished, t.total())
+	if t.failed > 0 {
+		items += fmt.Sprintf(", %d failed", t.failed)
+	}
+	if t.skipped > 0 {
+		items += fmt.Sprintf(", %d skipped", t.skipped)
+	}
+	parts = append(parts, items)
+	if t.lastArtworkPage != "" {
+		parts = append(parts, t.lastArtworkPage)
+	}
+	parts = append(parts, FormatBytes(t.bytes), "ETA "+t.eta())
+	fmt.Fprint(t.out, clearLine+strings.Join(parts, " | "))
+	t.drawn = true
+	t.lastDraw = time.Now()
+}
+
+// eta spreads the time spent on the processed items over the items still to process,
+// counting the pages of the current listing that are not listed yet like the pages that are. The lock must be held.
+func (t *Terminal) eta() string {
+	processed := t.done + t.failed
+	if processed <= 0 || t.firstStarted.IsZero() {
+		return "?"
+	}
+	remaining := t.total() - processed - t.skipped
+	if t.pages > t.page && t.page > 0 {
+		remaining += (t.pages - t.page) * t.listingListed / t.page
+	}
+	if remaining <= 0 {
+		return "0s"
+	}
+	perItem := time.Since(t.firstStarted) / time.Duration(processed)
+	return (perItem * time.Duration(remaining)).Round(time.Second).String()
+}
+
+// total is how many items were listed, or submitted without being listed. The lock must be held.
+func (t *Terminal) total() int {
+	if submitted := t.started + t.skipped; submitted > t.listed {
+		return submitted
+	}
+	return t.listed
+}
+
+// FormatBytes is n in B, KiB, MiB and so on
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,260 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+)
+
+// how an item of a run ended
+const (
+	OutcomeDownloaded     = "downloaded"
+	OutcomeAlreadyPresent = "already_present"
+	OutcomeFiltered       = "filtered"
+	OutcomeFailed         = "failed"
+)
+
+const (
+	fileTimeLayout = "20060102-150405"
+	jsonExt        = ".json"
+	summaryExt     = ".txt"
+)
+
+// Item is what happened to an artwork, or to a novel with a "novel/" ID
+type Item struct {
+	ID      string  `json:"id"`
+	Outcome string  `json:"outcome"`
+	Reason  string  `json:"reason,omitempty"` //why it was filtered out or failed
+	Pages   int     `json:"pages"`            //the pages of the artwork that were saved
+	Bytes   int64   `json:"bytes"`            //the bytes written for those pages
+	Seconds float64 `json:"seconds,omitempty"`
+}
+
+// ListingPage is a page of a listing that was gone through
+type ListingPage struct {
+	Listing string `json:"listing"`
+	Page    int    `json:"page"`
+	Pages   int    `json:"pages,omitempty"` //0 when unknown
+	Items   int    `json:"items"`
+}
+
+type Totals struct {
+	Downloaded     int   `json:"downloaded"`
+	AlreadyPresent int   `json:"alreadyPresent"`
+	Filtered       int   `json:"filtered"`
+	Failed         int   `json:"failed"`
+	Pages          int   `json:"pages"`
+	Bytes          int64 `json:"bytes"` //every byte written, the files that are not pages of an artwork included
+}
+
+// Report is the record of a run
+type Report struct {
+	Command      string        `json:"command"`
+	Args         []string      `json:"args,omitempty"`
+	Started      time.Time     `json:"started"`
+	Ended        time.Time     `json:"ended"`
+	Seconds      float64       `json:"seconds"`
+	Error        string        `json:"error,omitempty"` //what the run ended with
+	Totals       Totals        `json:"totals"`
+	ListingPages []ListingPage `json:"listingPages"`
+	Items        []Item        `json:"items"`
+}
+
+// Recorder builds the report of a run from its progress events
+type Recorder struct {
+	lock        sync.Mutex
+	report      Report
+	unsubscribe func()
+	items       map[string]*Item
+	order       []string
+	started     map[string]time.Time
+	pathOwners  map[string]*Item //the item a saved page belongs to
+	pathBytes   map[string]int64 //bytes written to a path that is not known to be a page yet
+}
+
+// NewRecorder starts recording the events of bus for the run of command with args
+func NewRecorder(bus *progress.Bus, command string, args []string) *Recorder {
+	r := &Recorder{
+		report: Report{
+			Command:      command,
+			Args:         args,
+			Started:      time.Now(),
+			ListingPages: []ListingPage{},
+			Items:        []Item{},
+		},
+		items:      make(map[string]*Item),
+		started:    make(map[string]time.Time),
+		pathOwners: make(map[string]*Item),
+		pathBytes:  make(map[string]int64),
+	}
+	r.unsubscribe = bus.Subscribe(r.handle)
+	return r
+}
+
+func (r *Recorder) item(id string) *Item {
+	item, ok := r.items[id]
+	if !ok {
+		item = &Item{ID: id}
+		r.items[id] = item
+		r.order = append(r.order, id)
+	}
+	return item
+}
+
+func (r *Recorder) handle(ev progress.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch ev.Kind {
+	case progress.ListingPage:
+		r.report.ListingPages = append(r.report.ListingPages, ListingPage{Listing: ev.Listing, Page: ev.Page, Pages: ev.Pages, Items: ev.Count})
+	case progress.ItemStarted:
+		r.item(ev.ID)
+		r.started[ev.ID] = ev.Time
+	case progress.ItemDone:
+		r.end(ev, OutcomeDownloaded, "")
+	case progress.ItemFailed:
+		reason := ""
+		if ev.Err != nil {
+			reason = fmt.Sprintf("%+v", ev.Err)
+		}
+		r.end(ev, OutcomeFailed, reason)
+	case progress.ItemSkipped:
+		//what the item was listed with first is what it is processed with
+		if _, ok := r.items[ev.ID]; ok && ev.Reason == progress.SkippedListed {
+			return
+		}
+		outcome := OutcomeFiltered
+		if ev.Reason == progress.SkippedDownloaded {
+			outcome = OutcomeAlreadyPresent
+		}
+		r.end(ev, outcome, ev.Reason)
+	case progress.PageSaved:
+		item := r.item(ev.ID)
+		item.Pages++
+		item.Bytes += r.pathBytes[ev.Path]
+		delete(r.pathBytes, ev.Path)
+		r.pathOwners[ev.Path] = item
+		r.report.Totals.Pages++
+	case progress.BytesWritten:
+		r.report.Totals.Bytes += ev.Bytes
+		if item, ok := r.pathOwners[ev.Path]; ok {
+			item.Bytes += ev.Bytes
+		} else {
+			r.pathBytes[ev.Path] += ev.Bytes
+		}
+	}
+}
+
+// end sets how the item of ev ended. The lock must be held.
+func (r *Recorder) end(ev progress.Event, outcome string, reason string) {
+	item := r.item(ev.ID)
+	item.Outcome = outcome
+	item.Reason = reason
+	if started, ok := r.started[ev.ID]; ok {
+		item.Seconds = ev.Time.Sub(started).Seconds()
+		delete(r.started, ev.ID)
+	}
+}
+
+// Finish stops recording and returns the report of the run, which ended with runErr
+func (r *Recorder) Finish(runErr error) Report {
+	r.unsubscribe()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	report := r.report
+	report.Ended = time.Now()
+	report.Seconds = report.Ended.Sub(report.Started).Seconds()
+	if runErr != nil {
+		report.Error = fmt.Sprintf("%+v", runErr)
+	}
+	report.Items = make([]Item, 0, len(r.order))
+	for _, id := range r.order {
+		item := *r.items[id]
+		switch item.Outcome {
+		case OutcomeDownloaded:
+			report.Totals.Downloaded++
+		case OutcomeAlreadyPresent:
+			report.Totals.AlreadyPresent++
+		case OutcomeFiltered:
+			report.Totals.Filtered++
+		case OutcomeFailed:
+			report.Totals.Failed++
+		default:
+			//started but never ended, as the run was cut short
+			item.Outcome = OutcomeFailed
+			item.Reason = "unfinished"
+			report.Totals.Failed++
+		}
+		report.Items = append(report.Items, item)
+	}
+	return report
+}
+
+// Summary is the report for a person to read
+func (report Report) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s run from %s to %s, took %s\n", report.Command, report.Started.Format(time.RFC3339),
+		report.Ended.Format(time.RFC3339), report.Ended.Sub(report.Started).Round(time.Second))
+	t := report.Totals
+	fmt.Fprintf(&b, "%d downloaded, %d already present, %d filtered, %d failed\n", t.Downloaded, t.AlreadyPresent, t.Filtered, t.Failed)
+	fmt.Fprintf(&b, "%d pages saved, %s written, %d listing pages gone through\n", t.Pages, progress.FormatBytes(t.Bytes), len(report.ListingPages))
+	for _, outcome := range []string{OutcomeFailed, OutcomeFiltered} {
+		var lines []string
+		for _, item := range report.Items {
+			if item.Outcome == outcome {
+				lines = append(lines, fmt.Sprintf("  %s: %s", item.ID, item.Reason))
+			}
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&b, "%s:\n%s\n", outcome, strings.Join(lines, "\n"))
+		}
+	}
+	if report.Error != "" {
+		fmt.Fprintf(&b, "ended with error: %s\n", report.Error)
+	}
+	return b.String()
+}
+
+// Save writes the report as json and its summary as text to dir, named after the start time and the command.
+// jsonPath is where the json went.
+func (report Report) Save(dir string) (jsonPath string, err error) {
+	name := report.Started.Format(fileTimeLayout) + "-" + report.Command
+	buf, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return jsonPath, fmt.Errorf("failed to marshal report: %+v", err)
+	}
+	jsonPath = filepath.Join(dir, name+jsonExt)
+	err = common.SaveFile(jsonPath, buf)
+	if err != nil {
+		return jsonPath, err
+	}
+	return jsonPath, common.SaveFile(filepath.Join(dir, name+summaryExt), []byte(report.Summary()))
+}
@@ -0,0 +1,193 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+)
+
+const (
+	DefaultInterval      = 2 * time.Second
+	DefaultJitter        = time.Second
+	DefaultThrottlePause = time.Minute
+
+	maxSlowdown = 32
+	//every slot taken after being throttled brings the slowdown this much closer to 1
+	recoveryFactor = 0.95
+)
+
+var (
+	pixivDomains = []string{"pixiv.net", "pximg.net"}
+
+	Scheduler = New(DefaultInterval, DefaultJitter, DefaultThrottlePause)
+)
+
+// scheduler hands out slots for requests to pixiv, shared by all tabs.
+// Slots are interval apart plus a random jitter. Once throttled it pauses and then
+// stretches the interval, shrinking it back a little with every slot.
+type scheduler struct {
+	lock          sync.Mutex
+	interval      time.Duration
+	jitter        time.Duration
+	throttlePause time.Duration
+	next          time.Time
+	pausedUntil   time.Time
+	slowdown      float64
+}
+
+// New creates a scheduler, see Configure for the values falling back to the defaults
+func New(interval time.Duration, jitter time.Duration, throttlePause time.Duration) *scheduler {
+	s := &scheduler{slowdown: 1}
+	s.Configure(interval, jitter, throttlePause)
+	return s
+}
+
+// Configure changes the rate. A negative interval or jitter falls back to the default, 0 turns it off.
+// A throttle pause that is not positive falls back to the default.
+func (s *scheduler) Configure(interval time.Duration, jitter time.Duration, throttlePause time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if interval < 0 {
+		interval = DefaultInterval
+	}
+	if jitter < 0 {
+		jitter = DefaultJitter
+	}
+	if throttlePause <= 0 {
+		throttlePause = DefaultThrottlePause
+	}
+	s.interval = interval
+	s.jitter = jitter
+	s.throttlePause = throttlePause
+}
+
+// Wait blocks until the next free slot
+func (s *scheduler) Wait(ctx context.Context) (err error) {
+	s.lock.Lock()
+	now := time.Now()
+	slot := s.next
+	if slot.Before(now) {
+		slot = now
+	}
+	if slot.Before(s.pausedUntil) {
+		slot = s.pausedUntil
+	}
+	gap := time.Duration(float64(s.interval) * s.slowdown)
+	if s.jitter > 0 {
+		gap += time.Duration(rand.Int63n(int64(s.jitter) + 1))
+	}
+	s.next = slot.Add(gap)
+	if s.slowdown > 1 {
+		s.slowdown *= recoveryFactor
+		if s.slowdown < 1 {
+			s.slowdown = 1
+		}
+	}
+	s.lock.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Throttled pauses all slots and doubles the interval. Reports that come in while
+// already paused are the same burst and are ignored.
+func (s *scheduler) Throttled(reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if now.Before(s.pausedUntil) {
+		return
+	}
+	s.slowdown *= 2
+	if s.slowdown > maxSlowdown {
+		s.slowdown = maxSlowdown
+	}
+	s.pausedUntil = now.Add(s.throttlePause)
+	logging.Warn("throttled by pixiv", "reason", reason, "pause", s.throttlePause, "slowdown", s.slowdown)
+}
+
+// Pause waits for the next free slot. It replaces fixed sleeps between browser steps.
+func Pause() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		return Scheduler.Wait(ctx)
+	})
+}
+
+// IsThrottleStatus tells if an http status means pixiv wants us to slow down
+func IsThrottleStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusForbidden
+}
+
+// WatchResponses reports the throttling responses seen by the tab of ctx
+func WatchResponses(ctx context.Context) {
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *network.EventResponseReceived:
+			resp := ev.Response
+			if resp != nil && isPixivUrl(resp.URL) && IsThrottleStatus(int(resp.Status)) {
+				Scheduler.Throttled(fmt.Sprintf("status %d for \"%s\"", resp.Status, resp.URL))
+			}
+		}
+	})
+}
+
+// isPixivUrl keeps the statuses of third party resources on the page from throttling us
+func isPixivUrl(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	for _, domain := range pixivDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRateLimitPage tells if the text of a page contains one of the rate limit texts
+func IsRateLimitPage(pageText string, rateLimitTexts []string) bool {
+	for _, text := range rateLimitTexts {
+		if text != "" && strings.Contains(pageText, text) {
+			return true
+		}
+	}
+	return false
+}
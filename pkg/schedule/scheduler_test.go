@@ -0,0 +1,149 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name                     string
+		interval, jitter, pause  time.Duration
+		wantInterval, wantJitter time.Duration
+		wantPause                time.Duration
+	}{
+		{"negative falls back to defaults", -1, -1, -1, DefaultInterval, DefaultJitter, DefaultThrottlePause},
+		{"zero interval and jitter are kept", 0, 0, 0, 0, 0, DefaultThrottlePause},
+		{"set values are kept", time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond,
+			time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(tt.interval, tt.jitter, tt.pause)
+			if s.interval != tt.wantInterval || s.jitter != tt.wantJitter || s.throttlePause != tt.wantPause {
+				t.Errorf("New(%v, %v, %v) = interval %v, jitter %v, pause %v, want %v, %v, %v",
+					tt.interval, tt.jitter, tt.pause, s.interval, s.jitter, s.throttlePause,
+					tt.wantInterval, tt.wantJitter, tt.wantPause)
+			}
+		})
+	}
+}
+
+func TestWaitPacing(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	s := New(interval, 0, time.Minute)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		err := s.Wait(context.Background())
+		if err != nil {
+			t.Fatalf("Wait() error = %+v", err)
+		}
+	}
+	//the first slot is free, every slot after is interval later
+	if elapsed := time.Since(start); elapsed < 3*interval {
+		t.Errorf("4 slots took %v, want at least %v", elapsed, 3*interval)
+	}
+}
+
+func TestWaitZeroInterval(t *testing.T) {
+	s := New(0, 0, time.Minute)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		err := s.Wait(context.Background())
+		if err != nil {
+			t.Fatalf("Wait() error = %+v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("100 slots without interval took %v", elapsed)
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	s := New(time.Hour, 0, time.Minute)
+	err := s.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Wait() error = %+v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = s.Wait(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Wait() error = %+v, want %+v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestThrottledBackoff(t *testing.T) {
+	const pause = 30 * time.Millisecond
+	s := New(0, 0, pause)
+	s.Throttled("test")
+	if s.slowdown != 2 {
+		t.Errorf("slowdown after throttled = %v, want 2", s.slowdown)
+	}
+	//reports during the pause are the same burst
+	s.Throttled("test")
+	if s.slowdown != 2 {
+		t.Errorf("slowdown after throttled while paused = %v, want 2", s.slowdown)
+	}
+
+	start := time.Now()
+	err := s.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Wait() error = %+v", err)
+	}
+	if elapsed := time.Since(start); elapsed < pause/2 {
+		t.Errorf("Wait() while paused took %v, want about %v", elapsed, pause)
+	}
+
+	for i := 0; i < 10; i++ {
+		s.pausedUntil = time.Time{}
+		s.Throttled("test")
+	}
+	if s.slowdown != maxSlowdown {
+		t.Errorf("slowdown after many throttles = %v, want %v", s.slowdown, maxSlowdown)
+	}
+}
+
+func TestThrottledRecovers(t *testing.T) {
+	s := New(0, 0, time.Millisecond)
+	s.Throttled("test")
+	s.pausedUntil = time.Time{}
+	err := s.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Wait() error = %+v", err)
+	}
+	if want := 2 * recoveryFactor; s.slowdown != want {
+		t.Errorf("slowdown after a slot = %v, want %v", s.slowdown, want)
+	}
+	for i := 0; i < 100; i++ {
+		err = s.Wait(context.Background())
+		if err != nil {
+			t.Fatalf("Wait() error = %+v", err)
+		}
+	}
+	if s.slowdown != 1 {
+		t.Errorf("slowdown after many slots = %v, want 1", s.slowdown)
+	}
+}
@@ -0,0 +1,118 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout is how long in-flight work may take to finish after a stop when ShutdownTimeout is unset
+	DefaultTimeout = 30 * time.Second
+)
+
+// ErrStopped is what a run that was asked to stop ends with
+var ErrStopped = errors.New("stopped before the run was done")
+
+// Stop is how a run is asked to stop. Once stopping no new work is started, once aborted the work in flight is cancelled too.
+type Stop struct {
+	stopping  chan struct{}
+	aborted   chan struct{}
+	stopOnce  sync.Once
+	abortOnce sync.Once
+}
+
+// New makes a stop that was not asked for yet
+func New() *Stop {
+	return &Stop{
+		stopping: make(chan struct{}),
+		aborted:  make(chan struct{}),
+	}
+}
+
+// Stop asks for no new work to be started
+func (s *Stop) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+	})
+}
+
+// Abort cancels the work in flight. It also stops.
+func (s *Stop) Abort() {
+	s.Stop()
+	s.abortOnce.Do(func() {
+		close(s.aborted)
+	})
+}
+
+// Stopping is closed once the run is asked to stop
+func (s *Stop) Stopping() <-chan struct{} {
+	return s.stopping
+}
+
+// Aborted is closed once the work in flight is cancelled
+func (s *Stop) Aborted() <-chan struct{} {
+	return s.aborted
+}
+
+type stopKey struct{}
+
+// NewContext makes s the stop of ctx
+func NewContext(ctx context.Context, s *Stop) context.Context {
+	return context.WithValue(ctx, stopKey{}, s)
+}
+
+// FromContext is the stop of ctx, or one that never fires when ctx has none
+func FromContext(ctx context.Context) *Stop {
+	if s, ok := ctx.Value(stopKey{}).(*Stop); ok {
+		return s
+	}
+	return New()
+}
+
+// Stopping tells if the run of ctx was asked to stop
+func Stopping(ctx context.Context) bool {
+	select {
+	case <-FromContext(ctx).Stopping():
+		return true
+	default:
+		return false
+	}
+}
+
+// WithAbort is ctx, also cancelled when the run of ctx is aborted. Work in flight should run under it
+// while what has to outlive it, like logging out, keeps using ctx.
+func WithAbort(ctx context.Context) (context.Context, context.CancelFunc) {
+	aborted := FromContext(ctx).Aborted()
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-aborted:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -25,14 +25,19 @@ import (
 	"context"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/chromedp"
 	"github.com/chromedp/chromedp/kb"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/download"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/paths"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
 )
 
 const (
@@ -92,8 +97,9 @@ func getAnchorNodesOfArtworkImg(ctx context.Context) (anchors []*cdp.Node, err e
 }
 
 func getArtworkImgNode(ctx context.Context) (imgNode *cdp.Node, err error) {
-	fmt.Printf("debug: enter getArtworkImgNode()\n")
-	defer fmt.Printf("debug: exit getArtworkImgNode()\n")
+	logger := logging.FromContext(ctx)
+	logger.Debug("enter getArtworkImgNode")
+	defer logger.Debug("exit getArtworkImgNode")
 	imgNodes, err := common.GetAllImgNodes(ctx)
 	if err != nil {
 		return imgNode, fmt.Errorf("failed to get all img nodes: %+v", err)
@@ -114,16 +120,21 @@ func getArtworkImgNode(ctx context.Context) (imgNode *cdp.Node, err error) {
 		return imgNode, fmt.Errorf("no img node has \"%s\" attr value matchs regex \"%s\"", config.SrcAttrName, config.ArtworkImgRe.String())
 	}
 	for i, node := range matchedNodes {
-		fmt.Printf("debug: matchedNodes[%d].src=\"%s\"\n", i, node.AttributeValue(config.SrcAttrName))
+		logger.Debug("matched img node", "index", i, "src", node.AttributeValue(config.SrcAttrName))
 	}
 	return matchedNodes[0], nil
 }
 
 func downloadMultiImgsArtwork(ctx context.Context, anchorNode *cdp.Node) (urls common.UrlMap, err error) {
-	err = chromedp.Run(ctx,
-		chromedp.Click(config.ImgNodeSel, chromedp.ByQuery, chromedp.FromNode(anchorNode)),
-		chromedp.Sleep(config.SavingRespWaitDura),
-	)
+	err = common.Retry(ctx, "clicking on artwork image", func() error {
+		loaded, stopListening := common.ListenForNetworkIdle(ctx, config.NetworkIdleDura, config.PageLoadTimeout)
+		defer stopListening()
+		return chromedp.Run(ctx,
+			schedule.Pause(),
+			chromedp.Click(config.ImgNodeSel, chromedp.ByQuery, chromedp.FromNode(anchorNode)),
+			loaded,
+		)
+	})
 	if err != nil {
 		return urls, fmt.Errorf("failed to click on artwork image: %+v", err)
 	}
@@ -148,30 +159,40 @@ func downloadSingleImgArtwork(ctx context.Context, anchorNode *cdp.Node) (urls c
 	urls = common.NewUrlMap()
 	urls.AddUrlsFromAnchorNodes([]*cdp.Node{anchorNode})
 
-	var imgNode *cdp.Node
-	for {
-		//keep clicking until it actually zoomed into the full res image for working wround two different clicking behaviors (move up/down or zoom in)
+	aHref := anchorNode.AttributeValue(config.HrefAttrName)
+	//keep clicking until it actually zoomed into the full res image for working wround two different clicking behaviors (move up/down or zoom in)
+	err = common.Retry(ctx, fmt.Sprintf("zooming into \"%s\"", aHref), func() error {
 		//to zoom in
-		err = chromedp.Run(ctx,
+		fullResLoaded, stopListening := common.ListenForImageResponse(ctx, func(url string) bool {
+			return url == aHref
+		}, config.ImageResponseTimeout)
+		defer stopListening()
+		err := chromedp.Run(ctx,
+			schedule.Pause(),
 			chromedp.MouseClickNode(anchorNode),
-			chromedp.Sleep(time.Second),
 		)
 		if err != nil {
-			return urls, fmt.Errorf("failed to click on artwork image: %+v", err)
+			return fmt.Errorf("failed to click on artwork image: %+v", err)
+		}
+		//a cached image is not requested again, the src check below tells if the click worked
+		err = chromedp.Run(ctx, fullResLoaded)
+		if err != nil {
+			logging.FromContext(ctx).Warn("full res image not loaded", logging.KeyError, err)
 		}
 		//double check if the src of img node match the href of the anchor node
-		imgNode, err = getArtworkImgNode(ctx)
+		imgNode, err := getArtworkImgNode(ctx)
 		if err != nil {
-			fmt.Printf("warning: unable to find img node for full res artwork: %+v. retrying\n", err)
-			continue
+			return fmt.Errorf("unable to find img node for full res artwork: %+v", err)
 		}
-
 		imgSrc := imgNode.AttributeValue(config.SrcAttrName)
-		aHref := anchorNode.AttributeValue(config.HrefAttrName)
-		if imgSrc == aHref {
-			fmt.Printf("img.src=\"%s\", a.href=\"%s\"\n", imgSrc, aHref)
-			break
+		if imgSrc != aHref {
+			return fmt.Errorf("img.src=\"%s\" does not match a.href=\"%s\"", imgSrc, aHref)
 		}
+		logging.FromContext(ctx).Debug("full res image shown", "src", imgSrc)
+		return nil
+	})
+	if err != nil {
+		return urls, err
 	}
 
 	err = EscapeFromFullResImg2(ctx)
@@ -183,57 +204,102 @@ func downloadSingleImgArtwork(ctx context.Context, anchorNode *cdp.Node) (urls c
 
 }
 
+func getArtworkID(ctx context.Context) (artworkID string, err error) {
+	var urlstr string
+	err = chromedp.Run(ctx,
+		chromedp.Location(&urlstr),
+	)
+	if err != nil {
+		return artworkID, fmt.Errorf("failed to get the url of current page: %+v", err)
+	}
+	artworkID = common.Get1stGroupMatch(urlstr, config.ArkworkerUrlSuffixRe)
+	if artworkID == "" {
+		return artworkID, fmt.Errorf("no 1st group match from \"%s\" using regex \"%s\"", urlstr, config.ArkworkerUrlSuffixRe.String())
+	}
+	return artworkID, nil
+}
+
 func downloadArtwork(ctx context.Context) (err error) {
-	anchorNode, multiImgs, err := getAnchorNodeOfArtworkImg(ctx)
+	artworkID, err := getArtworkID(ctx)
 	if err != nil {
-		return fmt.Errorf("unable to find anchor node of artwork: %+v", err)
+		return fmt.Errorf("unable to get artwork ID: %+v", err)
 	}
 
-	var urls common.UrlMap
-	waitDownload := download.ListenForNetworkEventAndDownloadArtworkImage(ctx)
-	defer func() {
-		errs := []error{err, waitDownload(urls)}
-		err = common.ConcatenateErrors(errs...)
-	}()
+	item := getArtworkItem(ctx)
+	if item.BookmarkList != "" {
+		state.Downloads.SetBookmarkList(artworkID, item.BookmarkList)
+	}
 
-	if multiImgs {
-		urls, err = downloadMultiImgsArtwork(ctx, anchorNode)
+	illust, detailErr := newBrowserApiClient(ctx).Illust(ctx, artworkID)
+	if detailErr != nil {
+		//the bookmark count is only known from the detail
+		if item.MinBookmarks > 0 {
+			return fmt.Errorf("unable to check the bookmarks of artwork %s against %d: %+v", artworkID, item.MinBookmarks, detailErr)
+		}
+		logging.FromContext(ctx).Warn("unable to get the artwork detail", logging.KeyError, detailErr)
+	}
+	if detailErr == nil && illust.BookmarkCount < item.MinBookmarks {
+		logging.FromContext(ctx).Info("skipping artwork with too few bookmarks", "bookmarks", illust.BookmarkCount, "minBookmarks", item.MinBookmarks)
+		skipItem(ctx, progress.SkippedFewBookmarks)
+		//recorded so that the artwork is not opened again for the same filter
+		return state.Downloads.MarkFewBookmarks(artworkID, illust.BookmarkCount)
+	}
+	values := getArtworkPathValues(artworkID, illust, item.BookmarkTag)
+	var pageCount int
+	//animated illustrations have no full res image to click on
+	if detailErr == nil && illust.IllustType == api.IllustTypeUgoira {
+		pageCount, err = downloadUgoira(ctx, artworkID, values)
 	} else {
-		urls, err = downloadSingleImgArtwork(ctx, anchorNode)
+		pageCount, err = downloadArtworkOriginals(ctx, artworkID, values)
 	}
 	if err != nil {
-		return fmt.Errorf("failed to click on artwork image: %+v", err)
+		return err
 	}
-	return nil
-}
 
-func navigateToArtworkPageAndDownloadArtwork(ctx context.Context, url string) (err error) {
-	err = chromedp.Run(ctx,
-		chromedp.Navigate(url),
-		chromedp.Sleep(time.Second*5),
-	)
+	//an artwork without its sidecar is not complete, so that the next run writes it
+	if detailErr != nil {
+		return fmt.Errorf("unable to write metadata of artwork %s: %+v", artworkID, detailErr)
+	}
+	err = writeArtworkMetadata(ctx, illust, values)
 	if err != nil {
-		return fmt.Errorf("failed to navigate to \"%s\": %+v", url, err)
+		return err
 	}
+	return state.Downloads.MarkComplete(artworkID, pageCount)
+}
 
-	err = downloadArtwork(ctx)
+func downloadArtworkImages(ctx context.Context, artworkID string, values paths.Values) (pageCount int, err error) {
+	var anchorNode *cdp.Node
+	var multiImgs bool
+	err = common.Retry(ctx, "finding the artwork image of "+artworkID, func() (err error) {
+		anchorNode, multiImgs, err = getAnchorNodeOfArtworkImg(ctx)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to download artwork at \"%s\"", url)
+		return pageCount, fmt.Errorf("unable to find anchor node of artwork: %+v", err)
 	}
 
-	return nil
-}
+	var urls common.UrlMap
+	waitDownload := download.ListenForNetworkEventAndDownloadArtworkImage(ctx, values)
+	defer func() {
+		pageCount = len(urls) //waitDownload empties urls
+		errs := []error{err, waitDownload(urls)}
+		err = common.ConcatenateErrors(errs...)
+	}()
 
-func EscapeFromFullResImg1(ctx context.Context, imgNode *cdp.Node) (err error) {
-	return chromedp.Run(ctx,
-		chromedp.MouseClickNode(imgNode),
-		chromedp.Sleep(time.Second),
-	)
+	if multiImgs {
+		urls, err = downloadMultiImgsArtwork(ctx, anchorNode)
+	} else {
+		urls, err = downloadSingleImgArtwork(ctx, anchorNode)
+	}
+	if err != nil {
+		return pageCount, fmt.Errorf("failed to click on artwork image: %+v", err)
+	}
+	return pageCount, nil
 }
 
 func EscapeFromFullResImg2(ctx context.Context) (err error) {
 	return chromedp.Run(ctx,
 		chromedp.KeyEvent(kb.Escape),
-		chromedp.Sleep(time.Second),
+		schedule.Pause(),
 	)
 }
@@ -25,13 +25,15 @@ import (
 	"context"
 	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/chromedp"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/download"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
 )
 
 func printBookmarkPage(ctx context.Context, bookmarkPage string, screenshotBuf *[]byte) (err error) {
@@ -43,12 +45,16 @@ func printBookmarkPage(ctx context.Context, bookmarkPage string, screenshotBuf *
 		err = common.ConcatenateErrors(errs...)
 	}()
 
-	err = chromedp.Run(ctx,
-		// go to bookmarks
-		chromedp.Navigate(bookmarkPage),
-		// just wait
-		chromedp.Sleep(5*time.Second),
-	)
+	err = common.Retry(ctx, "navigating to "+bookmarkPage, func() error {
+		loaded, stopListening := common.ListenForNetworkIdle(ctx, config.NetworkIdleDura, config.PageLoadTimeout)
+		defer stopListening()
+		return chromedp.Run(ctx,
+			schedule.Pause(),
+			// go to bookmarks
+			chromedp.Navigate(bookmarkPage),
+			loaded,
+		)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to navigate to bookmark page \"%s\": %+v", bookmarkPage, err)
 	}
@@ -60,8 +66,8 @@ func printBookmarkPage(ctx context.Context, bookmarkPage string, screenshotBuf *
 	}
 
 	err = chromedp.Run(ctx,
-		// just wait
-		chromedp.Sleep(2*time.Second),
+		// wait for the lazily loaded thumbnails
+		common.WaitElementCountStable(config.BookmarkItemImgSel, config.ElementStableDura, config.PageLoadTimeout),
 		// take screenshot
 		chromedp.FullScreenshot(screenshotBuf, 90),
 	)
@@ -192,12 +198,16 @@ func goToNextBookmarkPage(ctx context.Context) (noNext bool, err error) {
 		return true, nil
 	}
 
-	err = chromedp.Run(ctx,
-		chromedp.MouseClickNode(nextPageSvgNode),
-		chromedp.WaitVisible(config.TopLeftPixivImgSel, chromedp.ByQuery),
-		//just wait
-		chromedp.Sleep(time.Second),
-	)
+	err = common.Retry(ctx, "clicking on the next bookmark page button", func() error {
+		loaded, stopListening := common.ListenForNetworkIdle(ctx, config.NetworkIdleDura, config.PageLoadTimeout)
+		defer stopListening()
+		return chromedp.Run(ctx,
+			schedule.Pause(),
+			chromedp.MouseClickNode(nextPageSvgNode),
+			chromedp.WaitVisible(config.TopLeftPixivImgSel, chromedp.ByQuery),
+			loaded,
+		)
+	})
 
 	if err != nil {
 		return noNext, fmt.Errorf("failed to click on the next bookmark page button and wait for page to be loaded: %+v", err)
@@ -220,9 +230,9 @@ func goToNextBookmarkPageAndScrollToTheButtom(ctx context.Context) (noNext bool,
 		return noNext, urls, fmt.Errorf("unable to scroll to the buttom of page: %+v", err)
 	}
 
-	//just wait for some time for all bookmark items thumbnails to be loaded
+	//wait for all bookmark items thumbnails to be loaded
 	err = chromedp.Run(ctx,
-		chromedp.Sleep(time.Second*3),
+		common.WaitElementCountStable(config.BookmarkItemImgSel, config.ElementStableDura, config.PageLoadTimeout),
 	)
 
 	if err != nil {
@@ -259,12 +269,16 @@ func goToBookmarkPage(ctx context.Context) (err error) {
 		return fmt.Errorf("failed to get bookmark anchor node: %+v", err)
 	}
 
-	err = chromedp.Run(ctx,
-		chromedp.MouseClickNode(bmAnchorNode),
-		chromedp.WaitVisible(config.TopLeftPixivImgSel, chromedp.ByQuery),
-		// just wait
-		chromedp.Sleep(3*time.Second),
-	)
+	err = common.Retry(ctx, "clicking on the bookmark anchor", func() error {
+		loaded, stopListening := common.ListenForNetworkIdle(ctx, config.NetworkIdleDura, config.PageLoadTimeout)
+		defer stopListening()
+		return chromedp.Run(ctx,
+			schedule.Pause(),
+			chromedp.MouseClickNode(bmAnchorNode),
+			chromedp.WaitVisible(config.TopLeftPixivImgSel, chromedp.ByQuery),
+			loaded,
+		)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to click on to bookmark anchor: %+v", err)
 	}
@@ -288,9 +302,9 @@ func goToBookmarkPageAndScrollToTheButtom(ctx context.Context) (urls common.UrlM
 		return urls, fmt.Errorf("unable to scroll to the buttom of page: %+v", err)
 	}
 
-	//just wait for some time for all bookmark items thumbnails to be loaded
+	//wait for all bookmark items thumbnails to be loaded
 	err = chromedp.Run(ctx,
-		chromedp.Sleep(time.Second*3),
+		common.WaitElementCountStable(config.BookmarkItemImgSel, config.ElementStableDura, config.PageLoadTimeout),
 	)
 
 	if err != nil {
@@ -308,6 +322,42 @@ func goToBookmarkPageAndScrollToTheButtom(ctx context.Context) (urls common.UrlM
 	return urls, nil
 }
 
+// goToBookmarkListPageAndScrollToTheButtom goes straight to the first page of a bookmark listing of the logged in user
+func goToBookmarkListPageAndScrollToTheButtom(ctx context.Context, listing bookmarkListing) (urls common.UrlMap, err error) {
+	bookmarkPage := listing.pageUrl(config.Config.UserID)
+	err = common.Retry(ctx, "navigating to "+bookmarkPage, func() error {
+		loaded, stopListening := common.ListenForNetworkIdle(ctx, config.NetworkIdleDura, config.PageLoadTimeout)
+		defer stopListening()
+		return chromedp.Run(ctx,
+			schedule.Pause(),
+			chromedp.Navigate(bookmarkPage),
+			loaded,
+		)
+	})
+	if err != nil {
+		return urls, fmt.Errorf("failed to navigate to bookmark page \"%s\": %+v", bookmarkPage, err)
+	}
+
+	err = common.ScrollToButtomOfPage(ctx)
+	if err != nil {
+		return urls, fmt.Errorf("unable to scroll to the buttom of page: %+v", err)
+	}
+	err = chromedp.Run(ctx,
+		common.WaitElementCountStable(config.BookmarkItemImgSel, config.ElementStableDura, config.PageLoadTimeout),
+	)
+	if err != nil {
+		return urls, err
+	}
+
+	thumbnailNodes, err := getBookmarkItemThumbnailNodes(ctx)
+	if err != nil {
+		return urls, fmt.Errorf("unable to get thumbnail nodes on bookmark page: %+v", err)
+	}
+	urls = common.NewUrlMap()
+	urls.AddUrlsFromImgNodes(thumbnailNodes)
+	return urls, nil
+}
+
 func getUserID(ctx context.Context) (err error) {
 	var urlstr string
 	err = chromedp.Run(ctx,
@@ -324,8 +374,25 @@ func getUserID(ctx context.Context) (err error) {
 	return nil
 }
 
-func iterateBookmarkPages(ctx context.Context, maxIteration int,
-	toDo func(context.Context) error) (err error) {
+// findUserID reads the user ID off the bookmark page when UserID is not set, for what is only listed through the json endpoint
+func findUserID(ctx context.Context) (err error) {
+	if config.Config.UserID != "" {
+		return nil
+	}
+	err = goToBookmarkPage(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to go to bookmark page: %+v", err)
+	}
+	err = getUserID(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get user ID: %+v", err)
+	}
+	return nil
+}
+
+// iterateBookmarkPages calls toDo on every page of a bookmark listing. It stops early once toDo asks to stop.
+func iterateBookmarkPages(ctx context.Context, maxIteration int, listing bookmarkListing,
+	toDo func(context.Context) (stop bool, err error)) (err error) {
 
 	var urls common.UrlMap
 	waitDownload := download.ListenForNetworkEventAndDownloadBookmarkThumbnails(ctx)
@@ -341,14 +408,28 @@ func iterateBookmarkPages(ctx context.Context, maxIteration int,
 
 	warning := getUserID(ctx)
 	if warning != nil {
-		fmt.Printf("failed to get user ID: %+v", warning)
+		logging.FromContext(ctx).Warn("failed to get user ID", logging.KeyError, warning)
+	}
+
+	//the bookmark link behind the avatar always goes to the whole public list
+	if listing.List == bookmarkListPrivate || listing.Tag != "" {
+		if warning != nil {
+			return fmt.Errorf("unable to go to the %s without the user ID", listing)
+		}
+		urls, err = goToBookmarkListPageAndScrollToTheButtom(ctx, listing)
+		if err != nil {
+			return fmt.Errorf("failed to go to the page of %s and scroll to the bottom: %+v", listing, err)
+		}
 	}
 
 	if toDo != nil {
-		err = toDo(ctx)
+		stop, err := toDo(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to do toDo(): %+v", err)
 		}
+		if stop {
+			return nil
+		}
 	}
 
 	ithIteration := 2 //you will be on the 2nd page the 1st time when you click the next page button
@@ -371,10 +452,14 @@ func iterateBookmarkPages(ctx context.Context, maxIteration int,
 		}
 		urls.Aggregate(newUrls)
 		if toDo != nil {
-			err = toDo(ctx)
+			var stop bool
+			stop, err = toDo(ctx)
 			if err != nil {
 				return fmt.Errorf("failed to do toDo(): %+v", err)
 			}
+			if stop {
+				return nil
+			}
 		}
 		ithIteration++
 	}
@@ -426,38 +511,26 @@ func getBookmarkItemAnchorNodes(ctx context.Context) (anchorNodes []*cdp.Node, e
 	return anchorNodes, nil
 }
 
-func openBookmarkItemInNewTab(ctx context.Context,
-	toDo func(context.Context) error) (err error) {
+// submitBookmarkItems submits every bookmark item of the current page of listing, the page-th one.
+// In incremental mode items that were already downloaded are skipped, and allStored
+// tells if every item on the page was.
+func submitBookmarkItems(ctx context.Context, submitter *bookmarkSubmitter, listing bookmarkListing, page int) (allStored bool, err error) {
 	anchorNodes, err := getBookmarkItemAnchorNodes(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get bookmark item anchor nodes: %+v", err)
+		return allStored, fmt.Errorf("failed to get bookmark item anchor nodes: %+v", err)
 	}
+	var artworkIDs []string
 	for _, node := range anchorNodes {
-		err = func() error {
-			newTabCtx, cancel, err := common.ClickOnAnchorAndOpenNewTab(ctx, node)
-			defer func() {
-				cancel()
-			}()
-			if err != nil {
-				return fmt.Errorf("failed to click on anchor and open new tab: %+v", err)
-			}
-			//wait for some time for the page to be loaded
-			chromedp.Run(newTabCtx,
-				chromedp.Sleep(2*time.Second),
-			)
-			if toDo != nil {
-				err = toDo(newTabCtx)
-				if err != nil {
-					return fmt.Errorf("failed to do toDo(): %+v", err)
-				}
-			}
-			return nil
-		}()
-		if err != nil {
-			return err
+		hrefVal := node.AttributeValue(config.HrefAttrName)
+		artworkID := common.Get1stGroupMatch(hrefVal, config.ArkworkerUrlSuffixRe)
+		if artworkID == "" {
+			logging.FromContext(ctx).Error("no artwork ID in bookmark item link", logging.KeyUrl, hrefVal)
+			continue
 		}
+		artworkIDs = append(artworkIDs, artworkID)
 	}
-	return nil
+	//the number of bookmark pages is not shown
+	return submitArtworkPage(ctx, submitter, listing.item(), listing.String(), api.PagePosition{Number: page}, artworkIDs)
 }
 
 func getCloseTutorialBannerButton(ctx context.Context) (closeButton *cdp.Node, err error) {
@@ -496,7 +569,7 @@ func dismissTutorialBanner(ctx context.Context) (err error) {
 
 	err = chromedp.Run(ctx,
 		chromedp.MouseClickNode(closeButton),
-		chromedp.Sleep(time.Second),
+		schedule.Pause(),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to close button of tutorial banner: %+v", err)
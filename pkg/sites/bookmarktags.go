@@ -0,0 +1,149 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sites
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+)
+
+// bookmarkListing is a bookmark list narrowed down to the bookmarks carrying a bookmark tag of the user
+type bookmarkListing struct {
+	List string //public or private
+	Tag  string //empty for the whole list
+}
+
+func (l bookmarkListing) String() string {
+	if l.Tag == "" {
+		return l.List + " bookmarks"
+	}
+	return fmt.Sprintf("%s bookmarks tagged \"%s\"", l.List, l.Tag)
+}
+
+// item is what the artworks found in the listing are submitted with
+func (l bookmarkListing) item() artworkItem {
+	return artworkItem{BookmarkList: l.List, BookmarkTag: l.Tag}
+}
+
+func (l bookmarkListing) query() api.BookmarkQuery {
+	return api.BookmarkQuery{Rest: getBookmarkListRest(l.List), Tag: l.Tag}
+}
+
+// pageUrl is the first page of the listing for the user
+func (l bookmarkListing) pageUrl(userID string) string {
+	if l.Tag == "" {
+		return fmt.Sprintf(config.BookmarkUrlFormat, userID, l.query().Rest)
+	}
+	return fmt.Sprintf(config.TaggedBookmarkUrlFormat, userID, url.PathEscape(l.Tag), l.query().Rest)
+}
+
+// getBookmarkListings is every listing to go through: every list, once per tag of BookmarkTags when set
+func getBookmarkListings(lists []string) (listings []bookmarkListing) {
+	for _, list := range lists {
+		if len(config.Config.BookmarkTags) <= 0 {
+			listings = append(listings, bookmarkListing{List: list})
+			continue
+		}
+		for _, tag := range config.Config.BookmarkTags {
+			listings = append(listings, bookmarkListing{List: list, Tag: tag})
+		}
+	}
+	return listings
+}
+
+// bookmarkSubmitter submits bookmarks to the tab pool. An artwork listed under several bookmark tags is
+// only submitted once, and artworks carrying a tag of ExcludeBookmarkTags are not submitted at all.
+type bookmarkSubmitter struct {
+	pool     *tabPool
+	excluded map[string]struct{} //read only once the submitter is made
+
+	lock      sync.Mutex
+	submitted map[string]struct{}
+}
+
+// newBookmarkSubmitter submits to pool, skipping the artworks in excluded, see listExcludedBookmarks
+func newBookmarkSubmitter(pool *tabPool, excluded map[string]struct{}) *bookmarkSubmitter {
+	return &bookmarkSubmitter{
+		pool:      pool,
+		excluded:  excluded,
+		submitted: make(map[string]struct{}),
+	}
+}
+
+// Submit submits the artwork with what item says about where it was found, unless it is filtered out
+func (s *bookmarkSubmitter) Submit(ctx context.Context, item artworkItem, artworkID string) (err error) {
+	_, excluded := s.excluded[artworkID]
+	s.lock.Lock()
+	_, submitted := s.submitted[artworkID]
+	s.submitted[artworkID] = struct{}{}
+	s.lock.Unlock()
+
+	if excluded {
+		logging.FromContext(ctx).Info("skipping artwork with an excluded bookmark tag", logging.KeyArtwork, artworkID)
+		emitSkipped(artworkID, item, progress.SkippedExcludedTag)
+		return nil
+	}
+	if submitted {
+		emitSkipped(artworkID, item, progress.SkippedListed)
+		return nil
+	}
+	item.Url = getArtworkUrl(artworkID)
+	return s.pool.Submit(ctx, item)
+}
+
+// listExcludedBookmarks lists the bookmarks carrying a tag of ExcludeBookmarkTags in every list, through the json endpoint.
+// It is done before the tab pool is started, as the user ID may have to be looked up on the bookmark page in the main tab.
+func listExcludedBookmarks(ctx context.Context, lists []string) (excluded map[string]struct{}, err error) {
+	excluded = make(map[string]struct{})
+	if len(config.Config.ExcludeBookmarkTags) <= 0 {
+		return excluded, nil
+	}
+	err = findUserID(ctx)
+	if err != nil {
+		return excluded, fmt.Errorf("unable to list the bookmarks of ExcludeBookmarkTags: %+v", err)
+	}
+	client := newBrowserApiClient(ctx)
+	handle := func(bookmarks []api.Bookmark, _ api.PagePosition) (stop bool, err error) {
+		for _, bookmark := range bookmarks {
+			excluded[string(bookmark.ID)] = struct{}{}
+		}
+		return false, nil
+	}
+	for _, list := range lists {
+		for _, tag := range config.Config.ExcludeBookmarkTags {
+			listing := bookmarkListing{List: list, Tag: tag}
+			err = client.EnumerateBookmarks(ctx, config.Config.UserID, listing.query(), api.DefaultBookmarkPageSize, 0, handle)
+			if err != nil {
+				return excluded, fmt.Errorf("unable to list the %s: %+v", listing, err)
+			}
+		}
+	}
+	return excluded, nil
+}
@@ -0,0 +1,118 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package sites
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/download"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/paths"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
+)
+
+// setupDirectDownloader hands the cookies of the logged in browser to the direct downloader
+func setupDirectDownloader(ctx context.Context) (err error) {
+	var cookies []*network.Cookie
+	err = chromedp.Run(ctx,
+		chromedp.ActionFunc(func(ctx context.Context) (err error) {
+			cookies, err = network.GetAllCookies().Do(ctx)
+			return err
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get cookies from browser: %+v", err)
+	}
+	jar, err := download.NewCookieJar(cookies)
+	if err != nil {
+		return err
+	}
+	download.Direct = download.NewDirectDownloader(&http.Client{Jar: jar}, config.Config.MaxDownloads)
+	return nil
+}
+
+// downloadArtworkOriginals downloads the pages directly unless BrowserCapture is set.
+// It falls back to capturing them from the browser when the page urls are unknown.
+// The artwork is left for the caller to mark complete.
+func downloadArtworkOriginals(ctx context.Context, artworkID string, values paths.Values) (pageCount int, err error) {
+	if !config.Config.BrowserCapture {
+		pages, err := getOriginalPageUrls(ctx, artworkID)
+		if err == nil {
+			return downloadArtworkImagesDirectly(ctx, artworkID, values, pages)
+		}
+		logging.FromContext(ctx).Warn("capturing the pages from the browser instead", logging.KeyError, err)
+	}
+	return downloadArtworkImages(ctx, artworkID, values)
+}
+
+// downloadArtworkImagesDirectly downloads every page of the artwork from its original url
+func downloadArtworkImagesDirectly(ctx context.Context, artworkID string, values paths.Values, pages []string) (pageCount int, err error) {
+	var wg sync.WaitGroup
+	var errs common.Errors
+	for i, pageUrl := range pages {
+		filePath, err := common.GetArtworkPagePath(values, pageUrl)
+		if err != nil {
+			errs.Add(err)
+			continue
+		}
+		wg.Add(1)
+		go func(page int, pageUrl string, filePath string) {
+			defer wg.Done()
+			pageCtx := logging.NewContext(ctx, logging.FromContext(ctx).With(logging.KeyPage, page))
+			_, err := download.Direct.Download(pageCtx, pageUrl, filePath)
+			if err != nil {
+				errs.Add(err)
+				return
+			}
+			state.Downloads.AddPage(artworkID, page, filePath)
+			progress.Emit(progress.Event{Kind: progress.PageSaved, ID: artworkID, ArtworkPage: page + 1, ArtworkPages: len(pages), Path: filePath})
+		}(i, pageUrl, filePath)
+	}
+	wg.Wait()
+	return len(pages), errs.Get()
+}
+
+// getOriginalPageUrls asks the json endpoint for the original image url of every page
+func getOriginalPageUrls(ctx context.Context, artworkID string) (urls []string, err error) {
+	pages, err := newBrowserApiClient(ctx).IllustPages(ctx, artworkID)
+	if err != nil {
+		return urls, err
+	}
+	for _, page := range pages {
+		if page.Urls.Original == "" {
+			return urls, fmt.Errorf("no original url for a page of artwork %s", artworkID)
+		}
+		urls = append(urls, page.Urls.Original)
+	}
+	if len(urls) <= 0 {
+		return urls, fmt.Errorf("artwork %s has no pages", artworkID)
+	}
+	return urls, nil
+}
@@ -0,0 +1,277 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package sites
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/shutdown"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
+)
+
+const (
+	//the bookmark lists, as recorded with every artwork
+	bookmarkListPublic     = `public`
+	bookmarkListPrivate    = `private`
+	bookmarkVisibilityBoth = `both`
+
+	fetchJsFormat = `fetch(%s, {credentials: "same-origin"}).then(async (resp) => ({status: resp.status, body: await resp.text()}))`
+)
+
+type fetchResult struct {
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+}
+
+// browserFetch does the request from inside the page so that it carries the cookies of the logged in session
+func browserFetch(ctx context.Context, rawUrl string) (body []byte, err error) {
+	quotedUrl, err := json.Marshal(rawUrl)
+	if err != nil {
+		return body, fmt.Errorf("unable to quote url \"%s\": %+v", rawUrl, err)
+	}
+	var result fetchResult
+	err = chromedp.Run(ctx,
+		schedule.Pause(),
+		chromedp.Evaluate(fmt.Sprintf(fetchJsFormat, quotedUrl), &result, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}),
+	)
+	if err != nil {
+		return body, fmt.Errorf("failed to fetch \"%s\" in browser: %+v", rawUrl, err)
+	}
+	if result.Status < 200 || result.Status > 299 {
+		if schedule.IsThrottleStatus(result.Status) {
+			schedule.Scheduler.Throttled(fmt.Sprintf("status %d for \"%s\"", result.Status, rawUrl))
+		}
+		return body, &api.StatusError{Url: rawUrl, StatusCode: result.Status}
+	}
+	return []byte(result.Body), nil
+}
+
+func newBrowserApiClient(ctx context.Context) *api.Client {
+	return &api.Client{
+		BaseUrl: config.PixivSiteUrl,
+		Fetch: func(_ context.Context, rawUrl string) (body []byte, err error) {
+			err = common.Retry(ctx, "fetching "+rawUrl, func() (err error) {
+				body, err = browserFetch(ctx, rawUrl)
+				return err
+			})
+			return body, err
+		},
+	}
+}
+
+// checkRateLimitPage fails the step when pixiv shows its rate limit page instead, and tells the scheduler
+func checkRateLimitPage() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		var pageText string
+		err := chromedp.Evaluate(`document.body ? document.body.innerText : ""`, &pageText).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to read the text of the page: %+v", err)
+		}
+		texts := config.Config.RateLimitPageTexts
+		if len(texts) <= 0 {
+			texts = config.DefaultRateLimitPageTexts
+		}
+		if schedule.IsRateLimitPage(pageText, texts) {
+			schedule.Scheduler.Throttled("rate limit page")
+			return fmt.Errorf("pixiv showed its rate limit page")
+		}
+		return nil
+	})
+}
+
+func getArtworkUrl(artworkID string) string {
+	return fmt.Sprintf(config.ArtworkUrlFormat, artworkID)
+}
+
+// openArtworkInTab opens the artwork page in the tab of tabCtx and calls toDo
+func openArtworkInTab(tabCtx context.Context, artworkUrl string,
+	toDo func(context.Context) error) (err error) {
+	//listeners added by toDo are removed once the item is done, as the tab is reused
+	itemCtx, cancel := context.WithCancel(tabCtx)
+	defer cancel()
+
+	err = common.Retry(itemCtx, "navigating to "+artworkUrl, func() error {
+		loaded, stopListening := common.ListenForNetworkIdle(itemCtx, config.NetworkIdleDura, config.PageLoadTimeout)
+		defer stopListening()
+		return chromedp.Run(itemCtx,
+			schedule.Pause(),
+			chromedp.Navigate(artworkUrl),
+			checkRateLimitPage(),
+			chromedp.WaitVisible(config.TopLeftPixivImgSel, chromedp.ByQuery),
+			// wait for the artwork to be loaded
+			loaded,
+		)
+	})
+	if err != nil {
+		return &stageError{stage: stageOpen, err: fmt.Errorf("failed to navigate to \"%s\": %+v", artworkUrl, err)}
+	}
+	if toDo != nil {
+		err = toDo(itemCtx)
+		if err != nil {
+			return &stageError{stage: stageProcess, err: fmt.Errorf("failed to do toDo() on \"%s\": %+v", artworkUrl, err)}
+		}
+	}
+	return nil
+}
+
+// getBookmarkLists turns BookmarkVisibility into the bookmark lists to go through
+func getBookmarkLists() (lists []string, err error) {
+	switch config.Config.BookmarkVisibility {
+	case "", bookmarkListPublic:
+		return []string{bookmarkListPublic}, nil
+	case bookmarkListPrivate:
+		return []string{bookmarkListPrivate}, nil
+	case bookmarkVisibilityBoth:
+		return []string{bookmarkListPublic, bookmarkListPrivate}, nil
+	}
+	return lists, fmt.Errorf("BookmarkVisibility is \"%s\", it should be %s, %s or %s",
+		config.Config.BookmarkVisibility, bookmarkListPublic, bookmarkListPrivate, bookmarkVisibilityBoth)
+}
+
+// getBookmarkListRest is the rest query parameter pixiv uses for a bookmark list
+func getBookmarkListRest(list string) string {
+	if list == bookmarkListPrivate {
+		return api.RestHide
+	}
+	return api.RestShow
+}
+
+// iterateBookmarksWithApi enumerates a bookmark listing through the json endpoint and submits every artwork.
+// listed tells if the endpoint ever answered, so that the caller can fall back to scraping the bookmark pages.
+func iterateBookmarksWithApi(ctx context.Context, userID string, listing bookmarkListing, maxPages int,
+	submitter *bookmarkSubmitter) (listed bool, err error) {
+	client := newBrowserApiClient(ctx)
+	handle := func(bookmarks []api.Bookmark, position api.PagePosition) (stop bool, err error) {
+		listed = true
+		var artworkIDs []string
+		for _, bookmark := range bookmarks {
+			if bookmark.IsMasked {
+				logging.FromContext(ctx).Info("skipping unavailable artwork", logging.KeyArtwork, string(bookmark.ID))
+				continue
+			}
+			artworkIDs = append(artworkIDs, string(bookmark.ID))
+		}
+		return submitArtworkPage(ctx, submitter, listing.item(), listing.String(), position, artworkIDs)
+	}
+	err = client.EnumerateBookmarks(ctx, userID, listing.query(), api.DefaultBookmarkPageSize, maxPages, handle)
+	return listed, err
+}
+
+// submitArtworkPage submits a page of artworks listed under listing with item. Artworks an earlier run found to have
+// fewer than item.MinBookmarks are skipped. In incremental mode the downloaded artworks are skipped too, and stop tells
+// if every artwork on the page was. stop is also true once the run is asked to stop.
+func submitArtworkPage(ctx context.Context, submitter *bookmarkSubmitter, item artworkItem, listing string,
+	position api.PagePosition, artworkIDs []string) (stop bool, err error) {
+	progress.Emit(progress.Event{Kind: progress.ListingPage, Listing: listing,
+		Page: position.Number, Pages: position.Pages, Count: len(artworkIDs)})
+	item.Count = len(artworkIDs)
+	var toSubmit []int
+	for i, artworkID := range artworkIDs {
+		if item.MinBookmarks > 0 && state.Downloads.HasFewBookmarks(artworkID, item.MinBookmarks) {
+			logging.FromContext(ctx).Info("skipping artwork with too few bookmarks", logging.KeyArtwork, artworkID)
+			item.Index = i + 1
+			emitSkipped(artworkID, item, progress.SkippedFewBookmarks)
+			continue
+		}
+		if config.Config.Incremental && state.Downloads.IsComplete(artworkID) {
+			logging.FromContext(ctx).Info("skipping downloaded artwork", logging.KeyArtwork, artworkID)
+			item.Index = i + 1
+			emitSkipped(artworkID, item, progress.SkippedDownloaded)
+			continue
+		}
+		toSubmit = append(toSubmit, i)
+	}
+	if config.Config.Incremental && len(toSubmit) <= 0 {
+		return true, nil
+	}
+	for _, i := range toSubmit {
+		item.Index = i + 1
+		err = submitter.Submit(ctx, item, artworkIDs[i])
+		if errors.Is(err, shutdown.ErrStopped) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// iterateBookmarks goes through the bookmark lists set by BookmarkVisibility, narrowed down by BookmarkTags
+// and ExcludeBookmarkTags. It uses the json endpoint when the user ID is known and falls back to scraping the bookmark pages.
+// The artworks are processed across the tab pool while the bookmarks are listed.
+func iterateBookmarks(ctx context.Context, toDo func(context.Context) error) (err error) {
+	lists, err := getBookmarkLists()
+	if err != nil {
+		return err
+	}
+	excluded, err := listExcludedBookmarks(ctx, lists)
+	if err != nil {
+		return err
+	}
+	pool := newTabPool(ctx, toDo)
+	defer func() {
+		err = common.ConcatenateErrors(err, getResultsError(pool.Wait()))
+	}()
+
+	submitter := newBookmarkSubmitter(pool, excluded)
+	var errs []error
+	for _, listing := range getBookmarkListings(lists) {
+		if shutdown.Stopping(ctx) {
+			break
+		}
+		errs = append(errs, iterateBookmarkListing(ctx, listing, submitter))
+	}
+	return common.ConcatenateErrors(errs...)
+}
+
+func iterateBookmarkListing(ctx context.Context, listing bookmarkListing, submitter *bookmarkSubmitter) (err error) {
+	maxPages := config.Config.MaxBookmarkPageIteration
+	if config.Config.UserID != "" {
+		listed, err := iterateBookmarksWithApi(ctx, config.Config.UserID, listing, maxPages, submitter)
+		if listed || err == nil {
+			return err
+		}
+		logging.FromContext(ctx).Error("unable to list through the json endpoint, falling back to bookmark pages",
+			"listing", listing.String(), logging.KeyError, err)
+	}
+
+	page := 0
+	toDoOnPage := func(ctx context.Context) (stop bool, err error) {
+		page++
+		return submitBookmarkItems(ctx, submitter, listing, page)
+	}
+	return iterateBookmarkPages(ctx, maxPages, listing, toDoOnPage)
+}
@@ -0,0 +1,168 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sites
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/shutdown"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
+)
+
+// what an item was going through when it failed
+const (
+	stageOpen    = "open"    //opening the artwork page
+	stageProcess = "process" //downloading what the artwork page has
+	stageNovel   = "novel"   //getting and saving a novel
+)
+
+// stageError is an error of an item with the stage it happened in
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// getStage is the stage err happened in, stageProcess when unknown
+func getStage(err error) string {
+	var staged *stageError
+	if errors.As(err, &staged) {
+		return staged.stage
+	}
+	return stageProcess
+}
+
+// artworkFailure is the failure of the artwork of item with err
+func artworkFailure(artworkID string, item artworkItem, err error) state.Failure {
+	return state.Failure{
+		ID:           artworkID,
+		Url:          item.Url,
+		Stage:        getStage(err),
+		Error:        fmt.Sprintf("%+v", err),
+		BookmarkList: item.BookmarkList,
+		BookmarkTag:  item.BookmarkTag,
+		MinBookmarks: item.MinBookmarks,
+	}
+}
+
+// queueFailure records failure for the retry-failed command. A queue that cannot be written does not stop the run.
+func queueFailure(ctx context.Context, failure state.Failure) {
+	err := state.Failures.Add(failure)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to queue failure", logging.KeyError, err)
+	}
+}
+
+// unqueueFailure takes an item that is done out of the failure queue
+func unqueueFailure(ctx context.Context, id string) {
+	err := state.Failures.Remove(id)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to remove from failure queue", logging.KeyError, err)
+	}
+}
+
+// RetryFailed processes the queued failures again, the artworks across the tab pool and then the novels.
+// An entry leaves the queue once its item succeeds. Errors after some items were processed are returned as common.PartialError.
+func RetryFailed(ctx context.Context) (err error) {
+	err = loginAndLoadState(ctx)
+	if err != nil {
+		return err
+	}
+	failures := state.Failures.List()
+	if len(failures) <= 0 {
+		logging.FromContext(ctx).Info("no queued failures")
+		return endRun(ctx, nil)
+	}
+	logging.FromContext(ctx).Info("retrying queued failures", "count", len(failures))
+	progress.Emit(progress.Event{Kind: progress.ListingPage, Listing: "failure queue", Page: 1, Pages: 1, Count: len(failures)})
+
+	var artworks, novels []state.Failure
+	for _, failure := range failures {
+		if strings.HasPrefix(failure.ID, novelStatePrefix) {
+			novels = append(novels, failure)
+		} else {
+			artworks = append(artworks, failure)
+		}
+	}
+	err = common.ConcatenateErrors(retryFailedArtworks(ctx, artworks), retryFailedNovels(ctx, novels))
+	return endRun(ctx, err)
+}
+
+func retryFailedArtworks(ctx context.Context, failures []state.Failure) (err error) {
+	if len(failures) <= 0 {
+		return nil
+	}
+	pool := newTabPool(ctx, downloadArtwork)
+	defer func() {
+		err = common.ConcatenateErrors(err, getResultsError(pool.Wait()))
+	}()
+	for _, failure := range failures {
+		item := artworkItem{
+			Url:          failure.Url,
+			BookmarkList: failure.BookmarkList,
+			BookmarkTag:  failure.BookmarkTag,
+			MinBookmarks: failure.MinBookmarks,
+		}
+		if item.Url == "" {
+			item.Url = getArtworkUrl(failure.ID)
+		}
+		err = pool.Submit(ctx, item)
+		if errors.Is(err, shutdown.ErrStopped) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func retryFailedNovels(ctx context.Context, failures []state.Failure) (err error) {
+	if len(failures) <= 0 {
+		return nil
+	}
+	client := newBrowserApiClient(ctx)
+	var errs []error
+	for _, failure := range failures {
+		if shutdown.Stopping(ctx) {
+			break
+		}
+		listing := bookmarkListing{List: failure.BookmarkList, Tag: failure.BookmarkTag}
+		novelID := strings.TrimPrefix(failure.ID, novelStatePrefix)
+		errs = append(errs, processNovel(ctx, client, listing, novelID, progress.Event{ID: failure.ID}))
+	}
+	return common.ConcatenateErrors(errs...)
+}
@@ -24,12 +24,14 @@ package sites
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/chromedp"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/credentials"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
 )
 
 const (
@@ -66,19 +68,60 @@ func getSubmitLoginNode(ctx context.Context) (submitLoginNode *cdp.Node, err err
 	return getSubmitButtonNode(ctx, config.Config.LoginButtonText)
 }
 
+func getPasswordSources() credentials.Sources {
+	return credentials.Sources{
+		Password:       config.Config.Password,
+		PasswordFile:   config.Config.PasswordFile,
+		PasswordEnv:    config.Config.PasswordEnv,
+		PasswordCmd:    config.Config.PasswordCommand,
+		EncryptedFile:  config.Config.CredentialsFile,
+		PassphraseFile: config.Config.CredentialsPassphraseFile,
+		PassphraseEnv:  config.CredentialsPassphraseEnvName,
+	}
+}
+
+// EncryptPassword writes password to the credentials file, encrypted with the configured passphrase
+func EncryptPassword(password string) (err error) {
+	if config.Config.CredentialsFile == "" {
+		return fmt.Errorf("no CredentialsFile is set")
+	}
+	passphrase, err := credentials.ResolvePassphrase(getPasswordSources())
+	if err != nil {
+		return err
+	}
+	err = credentials.EncryptFile(config.Config.CredentialsFile, password, passphrase)
+	if err != nil {
+		return err
+	}
+	logging.Info("wrote file", logging.KeyPath, config.Config.CredentialsFile)
+	return nil
+}
+
 func navigateToPixivSiteAndClickLogin(ctx context.Context) (err error) {
-	return chromedp.Run(ctx,
+	err = chromedp.Run(ctx,
+		schedule.Pause(),
 		chromedp.Navigate(config.PixivSiteUrl),
 		// wait for element is visible (ie, page is loaded)
 		chromedp.WaitVisible(`a.signup-form__submit--login`, chromedp.ByQuery),
+	)
+	if err != nil {
+		return err
+	}
+	// the login form is loaded by the page after the click
+	formLoaded, stopListening := common.ListenForNetworkIdle(ctx, config.NetworkIdleDura, config.PageLoadTimeout)
+	defer stopListening()
+	return chromedp.Run(ctx,
 		// // find and click
 		chromedp.Click(`a.signup-form__submit--login`, chromedp.ByQuery, chromedp.NodeVisible),
-		// just wait
-		chromedp.Sleep(3*time.Second),
+		formLoaded,
 	)
 }
 
 func loginPixiv(ctx context.Context) (err error) {
+	if config.Config.Username == "" {
+		return fmt.Errorf("no Username is set in the config file, $PIXIV_DOWNLOADER_USERNAME or -username")
+	}
+
 	err = navigateToPixivSiteAndClickLogin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to navigate to pixiv login page: %+v", err)
@@ -89,11 +132,16 @@ func loginPixiv(ctx context.Context) (err error) {
 		return fmt.Errorf("unable to find input nodes of user or password: %+v", err)
 	}
 
+	password, err := credentials.Resolve(getPasswordSources())
+	if err != nil {
+		return fmt.Errorf("unable to get password: %+v", err)
+	}
+
 	err = chromedp.Run(ctx,
 		chromedp.SendKeys(config.AnySel, config.Config.Username, chromedp.ByQuery, common.TargetNode(userNode)),
-		chromedp.SendKeys(config.AnySel, config.Config.Password, chromedp.ByQuery, common.TargetNode(pwNode)),
+		chromedp.SendKeys(config.AnySel, password, chromedp.ByQuery, common.TargetNode(pwNode)),
 		// just wait
-		chromedp.Sleep(3*time.Second),
+		schedule.Pause(),
 	)
 	if err != nil {
 		return fmt.Errorf("unable to send keys to username or password input: %+v", err)
@@ -104,11 +152,13 @@ func loginPixiv(ctx context.Context) (err error) {
 		return fmt.Errorf("unable to find node of login button: %+v", err)
 	}
 
+	loggedIn, stopListening := common.ListenForNetworkIdle(ctx, config.NetworkIdleDura, config.PageLoadTimeout)
+	defer stopListening()
 	err = chromedp.Run(ctx,
+		schedule.Pause(),
 		chromedp.Click(config.AnySel, chromedp.ByQuery, common.TargetNode(loginNode)),
 		chromedp.WaitVisible(config.TopLeftPixivImgSel, chromedp.ByQuery),
-		// just wait
-		chromedp.Sleep(3*time.Second),
+		loggedIn,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to click login button: %+v", err)
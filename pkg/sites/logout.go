@@ -24,12 +24,12 @@ package sites
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/chromedp"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
 )
 
 func getLogoutButtonNode(ctx context.Context) (logoutButtonNode *cdp.Node, err error) {
@@ -57,7 +57,7 @@ func logoutPixiv(ctx context.Context) (err error) {
 	err = chromedp.Run(ctx,
 		chromedp.MouseClickNode(logoutButton),
 		// just wait
-		chromedp.Sleep(1*time.Second),
+		schedule.Pause(),
 	)
 	if err != nil {
 		return fmt.Errorf("unable to click the logout button: %+v", err)
@@ -67,13 +67,17 @@ func logoutPixiv(ctx context.Context) (err error) {
 	if err != nil {
 		return fmt.Errorf("unable to find logout confirmation button: %+v", err)
 	}
+	//confirming reloads the page
+	loggedOut, stopListening := common.ListenForLoadEvent(ctx, config.PageLoadTimeout)
+	defer stopListening()
 	err = chromedp.Run(ctx,
+		schedule.Pause(),
 		chromedp.MouseClickNode(logoutConfirmationButton),
-		// just wait
-		chromedp.Sleep(2*time.Second),
+		loggedOut,
 	)
 	if err != nil {
 		return fmt.Errorf("unable to click the logout button: %+v", err)
 	}
-	return nil
+	//the saved cookies are no longer valid after logging out
+	return removeSession()
 }
@@ -0,0 +1,59 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package sites
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/metadata"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/paths"
+)
+
+// writeArtworkMetadata writes the json sidecar of an artwork next to its images
+func writeArtworkMetadata(ctx context.Context, illust api.Illust, values paths.Values) (err error) {
+	artworkID := string(illust.ID)
+	var bookmark *api.BookmarkDetail
+	if illust.BookmarkData != nil {
+		bookmark, err = newBrowserApiClient(ctx).BookmarkDetail(ctx, artworkID)
+		if err != nil {
+			//the sidecar still has the bookmark ID and visibility from the artwork detail
+			logging.FromContext(ctx).Error("unable to get the bookmark detail", logging.KeyError, err)
+		}
+	}
+
+	artwork := metadata.NewArtwork(illust, bookmark, getArtworkUrl(artworkID))
+	artwork.BookmarkList = getArtworkItem(ctx).BookmarkList
+	filePath, err := getArtworkFilePath(values, config.MetadataFileSuffix)
+	if err != nil {
+		return fmt.Errorf("unable to get metadata path of artwork %s: %+v", artworkID, err)
+	}
+	err = metadata.Write(filePath, artwork)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("wrote file", logging.KeyPath, filePath)
+	return nil
+}
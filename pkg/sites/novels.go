@@ -0,0 +1,370 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sites
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/download"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/metadata"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/novel"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/paths"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/shutdown"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
+)
+
+const (
+	//the formats of the text of a novel, also its extension
+	novelFormatMarkdown = `md`
+	novelFormatText     = `txt`
+
+	novelEpubExt     = `epub`
+	novelMetadataExt = `json`
+	novelStatePrefix = `novel/` //novel and artwork IDs overlap in the state file
+)
+
+var coverMimeTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+}
+
+// getNovelFormat checks NovelFormat
+func getNovelFormat() (format string, err error) {
+	switch config.Config.NovelFormat {
+	case "", novelFormatMarkdown:
+		return novelFormatMarkdown, nil
+	case novelFormatText:
+		return novelFormatText, nil
+	}
+	return format, fmt.Errorf("NovelFormat is \"%s\", it should be %s or %s",
+		config.Config.NovelFormat, novelFormatMarkdown, novelFormatText)
+}
+
+// DoNovels downloads the bookmarked novels. Errors after some items were processed are returned as common.PartialError.
+func DoNovels(ctx context.Context) (err error) {
+	lists, err := getBookmarkLists()
+	if err != nil {
+		return err
+	}
+	_, err = getNovelFormat()
+	if err != nil {
+		return err
+	}
+	err = loginAndLoadState(ctx)
+	if err != nil {
+		return err
+	}
+	err = findUserID(ctx)
+	if err == nil {
+		err = iterateNovelBookmarks(ctx, lists)
+	}
+	return endRun(ctx, err)
+}
+
+// iterateNovelBookmarks downloads the novels of every bookmark listing, one after the other.
+// A novel that fails does not stop the others.
+func iterateNovelBookmarks(ctx context.Context, lists []string) (err error) {
+	client := newBrowserApiClient(ctx)
+	excluded, err := getExcludedNovelIDs(ctx, client, lists)
+	if err != nil {
+		return err
+	}
+
+	done := make(map[string]struct{}) //listed under an earlier bookmark tag
+	var errs []error
+	for _, listing := range getBookmarkListings(lists) {
+		if shutdown.Stopping(ctx) {
+			break
+		}
+		handle := func(bookmarks []api.NovelBookmark, position api.PagePosition) (stop bool, err error) {
+			var available []string
+			for _, bookmark := range bookmarks {
+				if bookmark.IsMasked {
+					logging.FromContext(ctx).Info("skipping unavailable novel", logging.KeyNovel, string(bookmark.ID))
+					continue
+				}
+				available = append(available, string(bookmark.ID))
+			}
+			progress.Emit(progress.Event{Kind: progress.ListingPage, Listing: "novels of the " + listing.String(),
+				Page: position.Number, Pages: position.Pages, Count: len(available)})
+			emit := func(ev progress.Event, i int) {
+				ev.ID, ev.Index, ev.Count = novelStatePrefix+available[i], i+1, len(available)
+				progress.Emit(ev)
+			}
+
+			var toDownload []int
+			for i, novelID := range available {
+				if config.Config.Incremental && state.Downloads.IsComplete(novelStatePrefix+novelID) {
+					logging.FromContext(ctx).Info("skipping downloaded novel", logging.KeyNovel, novelID)
+					emit(progress.Event{Kind: progress.ItemSkipped, Reason: progress.SkippedDownloaded}, i)
+					continue
+				}
+				toDownload = append(toDownload, i)
+			}
+			if config.Config.Incremental && len(toDownload) <= 0 {
+				return true, nil
+			}
+			for _, i := range toDownload {
+				if shutdown.Stopping(ctx) {
+					return true, nil
+				}
+				novelID := available[i]
+				if _, ok := excluded[novelID]; ok {
+					logging.FromContext(ctx).Info("skipping novel with an excluded bookmark tag", logging.KeyNovel, novelID)
+					emit(progress.Event{Kind: progress.ItemSkipped, Reason: progress.SkippedExcludedTag}, i)
+					continue
+				}
+				if _, ok := done[novelID]; ok {
+					emit(progress.Event{Kind: progress.ItemSkipped, Reason: progress.SkippedListed}, i)
+					continue
+				}
+				done[novelID] = struct{}{}
+				ev := progress.Event{ID: novelStatePrefix + novelID, Index: i + 1, Count: len(available)}
+				errs = append(errs, processNovel(ctx, client, listing, novelID, ev))
+			}
+			return false, nil
+		}
+		err = client.EnumerateNovelBookmarks(ctx, config.Config.UserID, listing.query(),
+			api.DefaultBookmarkPageSize, config.Config.MaxBookmarkPageIteration, handle)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to list the novels of the %s: %+v", listing, err))
+		}
+	}
+	return common.ConcatenateErrors(errs...)
+}
+
+// processNovel downloads a novel found in listing. ev tells where it was found, its progress is emitted with it.
+// A failed novel is queued for the retry-failed command and a downloaded one taken out of the queue.
+func processNovel(ctx context.Context, client *api.Client, listing bookmarkListing, novelID string, ev progress.Event) (err error) {
+	logger := logging.FromContext(ctx).With(logging.KeyNovel, novelID)
+	ctx = logging.NewContext(ctx, logger)
+	ctx, cancel := shutdown.WithAbort(ctx)
+	defer cancel()
+	defer countProcessedItem()
+	ev.Kind = progress.ItemStarted
+	progress.Emit(ev)
+	err = downloadNovel(ctx, client, listing, novelID)
+	if err != nil {
+		logger.Error("novel failed", logging.KeyError, err)
+		queueFailure(ctx, state.Failure{
+			ID:           novelStatePrefix + novelID,
+			Url:          getNovelUrl(novelID),
+			Stage:        stageNovel,
+			Error:        fmt.Sprintf("%+v", err),
+			BookmarkList: listing.List,
+			BookmarkTag:  listing.Tag,
+		})
+		ev.Kind, ev.Err = progress.ItemFailed, err
+		progress.Emit(ev)
+		return err
+	}
+	unqueueFailure(ctx, novelStatePrefix+novelID)
+	ev.Kind = progress.ItemDone
+	progress.Emit(ev)
+	return nil
+}
+
+// getExcludedNovelIDs lists the novels carrying a tag of ExcludeBookmarkTags in every list
+func getExcludedNovelIDs(ctx context.Context, client *api.Client, lists []string) (excluded map[string]struct{}, err error) {
+	excluded = make(map[string]struct{})
+	handle := func(bookmarks []api.NovelBookmark, _ api.PagePosition) (stop bool, err error) {
+		for _, bookmark := range bookmarks {
+			excluded[string(bookmark.ID)] = struct{}{}
+		}
+		return false, nil
+	}
+	for _, list := range lists {
+		for _, tag := range config.Config.ExcludeBookmarkTags {
+			listing := bookmarkListing{List: list, Tag: tag}
+			err = client.EnumerateNovelBookmarks(ctx, config.Config.UserID, listing.query(), api.DefaultBookmarkPageSize, 0, handle)
+			if err != nil {
+				return excluded, fmt.Errorf("unable to list the novels of the %s: %+v", listing, err)
+			}
+		}
+	}
+	return excluded, nil
+}
+
+func getNovelUrl(novelID string) string {
+	return fmt.Sprintf(config.NovelUrlFormat, novelID)
+}
+
+// getNovelFilePath is where the file of the novel with the extension ext goes
+func getNovelFilePath(values paths.Values, ext string) (filePath string, err error) {
+	withExt := paths.Values{paths.VarExt: ext}
+	for k, v := range values {
+		if k != paths.VarExt {
+			withExt[k] = v
+		}
+	}
+	return config.NovelPath(withExt)
+}
+
+func newNovelDocument(n api.Novel) novel.Document {
+	doc := novel.Document{
+		ID:        string(n.ID),
+		Title:     n.Title,
+		Author:    n.UserName,
+		AuthorUrl: fmt.Sprintf(config.UserUrlFormat, n.UserID),
+		Language:  n.Language,
+		SourceUrl: getNovelUrl(string(n.ID)),
+		Content:   n.Content,
+	}
+	for _, tag := range n.Tags.Tags {
+		doc.Tags = append(doc.Tags, tag.Tag)
+	}
+	if n.SeriesNavData != nil {
+		doc.SeriesTitle = n.SeriesNavData.Title
+		doc.SeriesUrl = fmt.Sprintf(config.NovelSeriesUrlFormat, n.SeriesNavData.SeriesID)
+		doc.SeriesOrder = n.SeriesNavData.Order
+	}
+	return doc
+}
+
+// downloadNovel saves the text, the cover, the metadata and optionally the epub of a novel
+func downloadNovel(ctx context.Context, client *api.Client, listing bookmarkListing, novelID string) (err error) {
+	n, err := client.Novel(ctx, novelID)
+	if err != nil {
+		return err
+	}
+	textPath, err := saveNovel(ctx, n, listing)
+	if err != nil {
+		return fmt.Errorf("failed to save novel %s: %+v", novelID, err)
+	}
+	stateKey := novelStatePrefix + novelID
+	state.Downloads.SetBookmarkList(stateKey, listing.List)
+	state.Downloads.AddPage(stateKey, 0, textPath)
+	return state.Downloads.MarkComplete(stateKey, 1)
+}
+
+func saveNovel(ctx context.Context, n api.Novel, listing bookmarkListing) (textPath string, err error) {
+	values := paths.Values{
+		paths.VarArtworkID:   string(n.ID),
+		paths.VarArtistID:    string(n.UserID),
+		paths.VarArtistName:  n.UserName,
+		paths.VarTitle:       n.Title,
+		paths.VarBookmarkTag: listing.Tag,
+		paths.VarPage:        0,
+		paths.VarFilename:    "",
+	}
+	doc := newNovelDocument(n)
+
+	//the novel is still worth keeping without its cover
+	cover, coverErr := downloadNovelCover(ctx, n, values)
+
+	format, _ := getNovelFormat()
+	textPath, err = getNovelFilePath(values, format)
+	if err != nil {
+		return textPath, common.ConcatenateErrors(coverErr, err)
+	}
+	text := novel.Markdown(doc)
+	if format == novelFormatText {
+		text = novel.Text(doc)
+	}
+	err = common.SaveFile(textPath, []byte(text))
+	if err != nil {
+		return textPath, common.ConcatenateErrors(coverErr, err)
+	}
+	logging.FromContext(ctx).Info("wrote file", logging.KeyPath, textPath)
+
+	var epubErr error
+	if config.Config.NovelEpub {
+		epubErr = writeNovelEpub(ctx, n, doc, cover, values)
+	}
+	return textPath, common.ConcatenateErrors(coverErr, epubErr, writeNovelMetadata(ctx, n, listing, values))
+}
+
+// downloadNovelCover downloads the cover next to the text. cover is nil when the novel has none.
+func downloadNovelCover(ctx context.Context, n api.Novel, values paths.Values) (cover *novel.Cover, err error) {
+	if n.CoverUrl == "" {
+		return nil, nil
+	}
+	ext := strings.ToLower(path.Ext(n.CoverUrl))
+	mimeType, ok := coverMimeTypes[ext]
+	if !ok {
+		return nil, fmt.Errorf("unknown type of cover \"%s\"", n.CoverUrl)
+	}
+	coverPath, err := getNovelFilePath(values, strings.TrimPrefix(ext, "."))
+	if err != nil {
+		return nil, err
+	}
+	_, err = download.Direct.Download(ctx, n.CoverUrl, coverPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download cover: %+v", err)
+	}
+	data, err := ioutil.ReadFile(coverPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cover at \"%s\": %+v", coverPath, err)
+	}
+	return &novel.Cover{Data: data, MimeType: mimeType}, nil
+}
+
+func writeNovelEpub(ctx context.Context, n api.Novel, doc novel.Document, cover *novel.Cover, values paths.Values) (err error) {
+	epubPath, err := getNovelFilePath(values, novelEpubExt)
+	if err != nil {
+		return err
+	}
+	modified, err := time.Parse(time.RFC3339, n.UploadDate)
+	if err != nil {
+		modified = time.Now()
+	}
+	var buf bytes.Buffer
+	err = novel.WriteEpub(&buf, doc, cover, modified)
+	if err != nil {
+		return err
+	}
+	err = common.SaveFile(epubPath, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("wrote file", logging.KeyPath, epubPath)
+	return nil
+}
+
+func writeNovelMetadata(ctx context.Context, n api.Novel, listing bookmarkListing, values paths.Values) (err error) {
+	metadataPath, err := getNovelFilePath(values, novelMetadataExt)
+	if err != nil {
+		return err
+	}
+	sidecar := metadata.NewNovel(n, getNovelUrl(string(n.ID)))
+	sidecar.BookmarkList = listing.List
+	err = metadata.Write(metadataPath, sidecar)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("wrote file", logging.KeyPath, metadataPath)
+	return nil
+}
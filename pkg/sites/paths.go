@@ -0,0 +1,61 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package sites
+
+import (
+	"path/filepath"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/paths"
+)
+
+// getArtworkPathValues are the values of the saved path template that are the same for every page of an artwork.
+// illust can be empty when its detail is not available.
+func getArtworkPathValues(artworkID string, illust api.Illust, bookmarkTag string) paths.Values {
+	return paths.Values{
+		paths.VarArtworkID:   artworkID,
+		paths.VarArtistID:    string(illust.UserID),
+		paths.VarArtistName:  illust.UserName,
+		paths.VarTitle:       illust.Title,
+		paths.VarBookmarkTag: bookmarkTag,
+	}
+}
+
+// getArtworkFilePath is where a file about the whole artwork, e.g. its metadata, is saved.
+// It goes to the directory of the first page and is named after the artwork ID.
+func getArtworkFilePath(values paths.Values, suffix string) (filePath string, err error) {
+	firstPage := paths.Values{
+		paths.VarPage:     0,
+		paths.VarExt:      "",
+		paths.VarFilename: "",
+	}
+	for k, v := range values {
+		firstPage[k] = v
+	}
+	firstPagePath, err := config.SavedPath(firstPage)
+	if err != nil {
+		return filePath, err
+	}
+	artworkID, _ := values[paths.VarArtworkID].(string)
+	return filepath.Join(filepath.Dir(firstPagePath), paths.SanitizeComponent(artworkID+suffix)), nil
+}
@@ -24,13 +24,16 @@ package sites
 import (
 	"context"
 	"fmt"
-	"log"
-	"time"
+	"strconv"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/chromedp"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
 	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/shutdown"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
 )
 
 func getSubmitButtonNode(ctx context.Context, buttonText string) (submitButtonNode *cdp.Node, err error) {
@@ -53,24 +56,147 @@ func getSubmitButtonNode(ctx context.Context, buttonText string) (submitButtonNo
 	return common.GetNodeWithText(ctx, buttonText, submitButtonNodes)
 }
 
-func DoPixiv(ctx context.Context) {
-	err := loginPixiv(ctx)
+// Login logs in to pixiv, reusing the saved session when it is still valid
+func Login(ctx context.Context) (err error) {
+	err = loginPixivWithSession(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to login: %+v", err)
 	}
+	return nil
+}
+
+// Logout logs out of the saved session, if there is one, and removes it
+func Logout(ctx context.Context) (err error) {
+	restored, err := restoreSession(ctx)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		logging.FromContext(ctx).Info("no saved session to logout from")
+		return nil
+	}
+	valid, err := isSessionValid(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check saved session: %+v", err)
+	}
+	if !valid {
+		return removeSession()
+	}
+	return logoutPixiv(ctx)
+}
+
+// endRun is done at the end of every run, also one asked to stop. runErr is what the run returned.
+// The saved session is kept for the next run unless LogoutAfterRun is set.
+// The error is a common.PartialError when the run got to some items or was stopped, e.g. not when listing failed.
+func endRun(ctx context.Context, runErr error) (err error) {
+	stopped := shutdown.Stopping(ctx)
+	if stopped {
+		runErr = common.ConcatenateErrors(runErr, shutdown.ErrStopped)
+	}
+	if config.Config.LogoutAfterRun {
+		err = logoutPixiv(ctx)
+		if err != nil {
+			err = fmt.Errorf("failed to logout: %+v", err)
+		}
+	}
+	err = common.ConcatenateErrors(runErr, err)
+	if err != nil && (stopped || getProcessedItems() > 0) {
+		return common.Partial(err)
+	}
+	return err
+}
+
+func loginAndLoadState(ctx context.Context) (err error) {
+	err = Login(ctx)
+	if err != nil {
+		return err
+	}
+	err = setupDirectDownloader(ctx)
+	if err != nil {
+		return err
+	}
+	err = state.Manifest.Load(config.ManifestPath(), config.Config.OutputRoot)
+	if err != nil {
+		return err
+	}
+	err = state.Failures.Load(config.FailuresPath())
+	if err != nil {
+		return err
+	}
+	return state.Downloads.Load(getStateFilePath())
+}
+
+// DoPixiv downloads the bookmarked artworks. Errors after some items were processed are returned as common.PartialError.
+func DoPixiv(ctx context.Context) (err error) {
+	_, err = getBookmarkLists()
+	if err != nil {
+		return err
+	}
+	err = loginAndLoadState(ctx)
+	if err != nil {
+		return err
+	}
+	err = iterateBookmarks(ctx, downloadArtwork)
+	return endRun(ctx, err)
+}
 
-	toDo := func(ctx context.Context) (err error) {
-		return openBookmarkItemInNewTab(ctx, downloadArtwork)
+// DownloadArtworks downloads the artworks given by url or ID. Errors after some items were processed are returned as common.PartialError.
+func DownloadArtworks(ctx context.Context, artworks []string) (err error) {
+	var urls []string
+	for _, artwork := range artworks {
+		url, err := parseArtworkArg(artwork)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, url)
 	}
-	err = iterateBookmarkPages(ctx, config.Config.MaxBookmarkPageIteration, toDo)
+
+	err = loginAndLoadState(ctx)
 	if err != nil {
-		log.Println(err)
+		return err
 	}
+	err = processArtworkUrls(ctx, urls, downloadArtwork)
+	return endRun(ctx, err)
+}
 
-	err = logoutPixiv(ctx)
+// SaveBookmarkThumbnails saves the thumbnails of all bookmark pages
+func SaveBookmarkThumbnails(ctx context.Context) (err error) {
+	lists, err := getBookmarkLists()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	err = Login(ctx)
+	if err != nil {
+		return err
+	}
+	//thumbnails are recorded in the manifest like every other saved file
+	err = state.Manifest.Load(config.ManifestPath(), config.Config.OutputRoot)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, listing := range getBookmarkListings(lists) {
+		errs = append(errs, iterateBookmarkPages(ctx, config.Config.MaxBookmarkPageIteration, listing, nil))
+	}
+	return endRun(ctx, common.ConcatenateErrors(errs...))
+}
+
+func parseArtworkArg(artwork string) (url string, err error) {
+	if _, err := strconv.Atoi(artwork); err == nil {
+		return getArtworkUrl(artwork), nil
+	}
+	artworkID := common.Get1stGroupMatch(artwork, config.ArkworkerUrlSuffixRe)
+	if artworkID == "" {
+		return url, fmt.Errorf("\"%s\" is neither an artwork url nor an artwork ID", artwork)
+	}
+	return getArtworkUrl(artworkID), nil
+}
+
+func getStateFilePath() string {
+	if config.Config.StateFile != "" {
+		return config.Config.StateFile
 	}
+	return config.DefaultStateFilePath
 }
 
 func getUserProfileImgNode(ctx context.Context) (userProfileImgNode *cdp.Node, err error) {
@@ -112,6 +238,6 @@ func clickUserProfileImage(ctx context.Context) (err error) {
 	return chromedp.Run(ctx,
 		chromedp.MouseClickNode(profileImgNode),
 		// just wait
-		chromedp.Sleep(1*time.Second),
+		schedule.Pause(),
 	)
 }
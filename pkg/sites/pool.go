@@ -0,0 +1,248 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package sites
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chromedp/chromedp"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/progress"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/schedule"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/shutdown"
+)
+
+const (
+	defaultTabs = 3
+)
+
+// artworkItem is an artwork to process and where it was found
+type artworkItem struct {
+	Url          string
+	BookmarkList string //public or private, empty when it was not found through the bookmarks
+	BookmarkTag  string //the bookmark tag it was listed under, empty when not filtering by bookmark tags
+	MinBookmarks int    //skip the artwork when fewer users bookmarked it
+	Index        int    //where the artwork is on its listing page, from 1. 0 when it was not listed
+	Count        int    //how many artworks its listing page has
+}
+
+type artworkItemKey struct{}
+
+// withArtworkItem lets toDo know which item it is processing
+func withArtworkItem(ctx context.Context, item artworkItem) context.Context {
+	return context.WithValue(ctx, artworkItemKey{}, item)
+}
+
+// getArtworkItem is the item being processed, or the zero item outside of the pool
+func getArtworkItem(ctx context.Context) artworkItem {
+	item, _ := ctx.Value(artworkItemKey{}).(artworkItem)
+	return item
+}
+
+type skipReasonKey struct{}
+
+// withSkipReason lets toDo tell that it left the item out through skipItem
+func withSkipReason(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipReasonKey{}, new(string))
+}
+
+// skipItem records that toDo left the item being processed out for reason
+func skipItem(ctx context.Context, reason string) {
+	if skipReason, ok := ctx.Value(skipReasonKey{}).(*string); ok {
+		*skipReason = reason
+	}
+}
+
+func getSkipReason(ctx context.Context) string {
+	if skipReason, ok := ctx.Value(skipReasonKey{}).(*string); ok {
+		return *skipReason
+	}
+	return ""
+}
+
+// processedItems is how many artworks and novels the run got to, whatever they ended with
+var processedItems int64
+
+func countProcessedItem() {
+	atomic.AddInt64(&processedItems, 1)
+}
+
+func getProcessedItems() int64 {
+	return atomic.LoadInt64(&processedItems)
+}
+
+// itemResult is what processing one artwork url ended with
+type itemResult struct {
+	Url string
+	Err error
+}
+
+// tabPool opens every submitted artwork url in one of a fixed number of tabs and calls toDo on it
+type tabPool struct {
+	items    chan artworkItem
+	inFlight chan struct{} //holds a token for every submitted item that is not done yet
+	wg       sync.WaitGroup
+	lock     sync.Mutex
+	results  []itemResult
+}
+
+// newTabPool starts the tabs. Tabs and MaxInFlight come from the config.
+func newTabPool(ctx context.Context, toDo func(context.Context) error) *tabPool {
+	tabs, maxInFlight := getTabPoolSize()
+	pool := &tabPool{
+		items:    make(chan artworkItem, maxInFlight),
+		inFlight: make(chan struct{}, maxInFlight),
+	}
+	for i := 0; i < tabs; i++ {
+		pool.wg.Add(1)
+		go pool.work(ctx, toDo)
+	}
+	return pool
+}
+
+func getTabPoolSize() (tabs int, maxInFlight int) {
+	tabs = config.Config.Tabs
+	if tabs <= 0 {
+		tabs = defaultTabs
+	}
+	maxInFlight = config.Config.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = tabs * 2
+	}
+	if maxInFlight < tabs {
+		tabs = maxInFlight
+	}
+	return tabs, maxInFlight
+}
+
+// Submit queues item and blocks while MaxInFlight items are already queued or being processed.
+// It returns shutdown.ErrStopped once the run is asked to stop.
+func (pool *tabPool) Submit(ctx context.Context, item artworkItem) (err error) {
+	if shutdown.Stopping(ctx) {
+		return shutdown.ErrStopped
+	}
+	select {
+	case pool.inFlight <- struct{}{}:
+	case <-shutdown.FromContext(ctx).Stopping():
+		return shutdown.ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	pool.items <- item
+	return nil
+}
+
+// Wait waits for all submitted items, closes the tabs and returns the result of every item
+func (pool *tabPool) Wait() (results []itemResult) {
+	close(pool.items)
+	pool.wg.Wait()
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	return pool.results
+}
+
+func (pool *tabPool) work(ctx context.Context, toDo func(context.Context) error) {
+	defer pool.wg.Done()
+	//an aborted run closes the tabs, but not the browser
+	abortCtx, cancelAbort := shutdown.WithAbort(ctx)
+	defer cancelAbort()
+	tabCtx, cancel := chromedp.NewContext(abortCtx)
+	defer cancel()
+	schedule.WatchResponses(tabCtx)
+	logger := logging.FromContext(ctx)
+	//the tab is only opened by the first action run in it, and its target ID only known after
+	if openErr := chromedp.Run(tabCtx); openErr == nil {
+		logger = logger.With(logging.KeyTab, chromedp.FromContext(tabCtx).Target.TargetID.String())
+	}
+	for item := range pool.items {
+		if shutdown.Stopping(ctx) {
+			//queued but not started yet
+			<-pool.inFlight
+			continue
+		}
+		artworkID := common.Get1stGroupMatch(item.Url, config.ArkworkerUrlSuffixRe)
+		itemLogger := logger.With(logging.KeyArtwork, artworkID)
+		itemCtx := withSkipReason(logging.NewContext(withArtworkItem(tabCtx, item), itemLogger))
+		emitItem(progress.ItemStarted, artworkID, item, nil)
+		err := openArtworkInTab(itemCtx, item.Url, toDo)
+		switch reason := getSkipReason(itemCtx); {
+		case err != nil:
+			itemLogger.Error("artwork failed", logging.KeyUrl, item.Url, "stage", getStage(err), logging.KeyError, err)
+			queueFailure(itemCtx, artworkFailure(artworkID, item, err))
+			emitItem(progress.ItemFailed, artworkID, item, err)
+		case reason != "":
+			unqueueFailure(itemCtx, artworkID)
+			emitSkipped(artworkID, item, reason)
+		default:
+			unqueueFailure(itemCtx, artworkID)
+			emitItem(progress.ItemDone, artworkID, item, nil)
+		}
+		countProcessedItem()
+		pool.lock.Lock()
+		pool.results = append(pool.results, itemResult{Url: item.Url, Err: err})
+		pool.lock.Unlock()
+		<-pool.inFlight
+	}
+}
+
+// emitItem reports what happened to the artwork artworkID of item
+func emitItem(kind progress.Kind, artworkID string, item artworkItem, err error) {
+	progress.Emit(progress.Event{Kind: kind, ID: artworkID, Index: item.Index, Count: item.Count, Err: err})
+}
+
+// emitSkipped reports that the artwork artworkID of item was left out for reason
+func emitSkipped(artworkID string, item artworkItem, reason string) {
+	progress.Emit(progress.Event{Kind: progress.ItemSkipped, ID: artworkID, Index: item.Index, Count: item.Count, Reason: reason})
+}
+
+// getResultsError concatenates the errors of the failed items
+func getResultsError(results []itemResult) error {
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("\"%s\": %+v", result.Url, result.Err))
+		}
+	}
+	return common.ConcatenateErrors(errs...)
+}
+
+// processArtworkUrls opens urls across the tab pool, calls toDo on each and waits for all of them
+func processArtworkUrls(ctx context.Context, urls []string, toDo func(context.Context) error) (err error) {
+	pool := newTabPool(ctx, toDo)
+	for _, url := range urls {
+		err = pool.Submit(ctx, artworkItem{Url: url})
+		if errors.Is(err, shutdown.ErrStopped) {
+			err = nil
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+	return common.ConcatenateErrors(err, getResultsError(pool.Wait()))
+}
@@ -0,0 +1,151 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sites
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/shutdown"
+)
+
+const (
+	rankingDateLayout = `20060102`
+)
+
+// the Content of a ranking as pixiv knows it
+var rankingContents = map[string]string{
+	"":       "",
+	"all":    "",
+	"illust": "illust",
+	"manga":  "manga",
+	"ugoira": "ugoira",
+}
+
+// getRankings are the rankings of the given modes, or Rankings when no mode is given
+func getRankings(modes []string) (rankings []config.Ranking, err error) {
+	if len(modes) <= 0 {
+		rankings = config.Config.Rankings
+	}
+	for _, mode := range modes {
+		rankings = append(rankings, config.Ranking{Mode: mode})
+	}
+	if len(rankings) <= 0 {
+		return rankings, fmt.Errorf("no ranking mode is given and Rankings is empty")
+	}
+	for _, r := range rankings {
+		if r.Mode == "" {
+			return rankings, fmt.Errorf("a ranking of Rankings has no Mode")
+		}
+		if _, ok := rankingContents[r.Content]; !ok {
+			return rankings, fmt.Errorf("Content of %s ranking is \"%s\", it should be all, illust, manga or ugoira", r.Mode, r.Content)
+		}
+		if r.Date != "" {
+			if _, err := time.Parse(rankingDateLayout, r.Date); err != nil {
+				return rankings, fmt.Errorf("Date of %s ranking is \"%s\", it should be YYYYMMDD", r.Mode, r.Date)
+			}
+		}
+	}
+	return rankings, nil
+}
+
+// DownloadRankings downloads the top artworks of the rankings of the given modes, or of Rankings.
+// Errors after some items were processed are returned as common.PartialError.
+func DownloadRankings(ctx context.Context, modes []string) (err error) {
+	rankings, err := getRankings(modes)
+	if err != nil {
+		return err
+	}
+	lists, err := getBookmarkLists()
+	if err != nil {
+		return err
+	}
+	err = loginAndLoadState(ctx)
+	if err != nil {
+		return err
+	}
+	err = iterateRankings(ctx, lists, rankings, downloadArtwork)
+	return endRun(ctx, err)
+}
+
+// iterateRankings submits the top artworks of every ranking to the tab pool.
+// Bookmarks carrying a tag of ExcludeBookmarkTags in lists are skipped like in the bookmark sync.
+func iterateRankings(ctx context.Context, lists []string, rankings []config.Ranking, toDo func(context.Context) error) (err error) {
+	excluded, err := listExcludedBookmarks(ctx, lists)
+	if err != nil {
+		return err
+	}
+	pool := newTabPool(ctx, toDo)
+	defer func() {
+		err = common.ConcatenateErrors(err, getResultsError(pool.Wait()))
+	}()
+
+	client := newBrowserApiClient(ctx)
+	submitter := newBookmarkSubmitter(pool, excluded)
+	var errs []error
+	for _, r := range rankings {
+		if shutdown.Stopping(ctx) {
+			break
+		}
+		errs = append(errs, iterateRanking(ctx, client, submitter, r))
+	}
+	return common.ConcatenateErrors(errs...)
+}
+
+func iterateRanking(ctx context.Context, client *api.Client, submitter *bookmarkSubmitter, r config.Ranking) (err error) {
+	maxItems := r.GetMaxItems()
+	listing := r.Mode + " ranking"
+	//the ranking may end before maxItems
+	pages := (maxItems + api.RankingPageSize - 1) / api.RankingPageSize
+	listed := 0
+	for page := 1; listed < maxItems; page++ {
+		items, hasNext, err := client.Ranking(ctx, r.Mode, rankingContents[r.Content], r.Date, page)
+		if err != nil {
+			return err
+		}
+		var artworkIDs []string
+		for _, item := range items {
+			if listed >= maxItems {
+				break
+			}
+			artworkIDs = append(artworkIDs, string(item.ID))
+			listed++
+		}
+		//a ranking is not in upload order, so a downloaded page says nothing about the next one
+		position := api.PagePosition{Number: page, Pages: pages}
+		_, err = submitArtworkPage(ctx, submitter, artworkItem{}, listing, position, artworkIDs)
+		if err != nil {
+			return err
+		}
+		if !hasNext || shutdown.Stopping(ctx) || len(items) <= 0 {
+			break
+		}
+	}
+	logging.FromContext(ctx).Info("listed artworks of ranking", "mode", r.Mode, "count", listed)
+	return nil
+}
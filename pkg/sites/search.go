@@ -0,0 +1,217 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sites
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/shutdown"
+)
+
+const (
+	searchDateLayout = `2006-01-02`
+)
+
+// the values of a saved search as pixiv knows them
+var (
+	searchTypes = map[string]string{
+		"":       "all",
+		"all":    "all",
+		"illust": "illust_and_ugoira",
+		"manga":  "manga",
+		"ugoira": "ugoira",
+	}
+	searchMatches = map[string]string{
+		"":        api.SearchMatchTag,
+		"tag":     api.SearchMatchTag,
+		"partial": api.SearchMatchPartial,
+		"text":    api.SearchMatchText,
+	}
+	searchModes = map[string]string{
+		"":     "all",
+		"all":  "all",
+		"safe": "safe",
+		"r18":  "r18",
+	}
+	searchOrders = map[string]string{
+		"":        api.SearchOrderNewest,
+		"newest":  api.SearchOrderNewest,
+		"oldest":  api.SearchOrderOldest,
+		"popular": api.SearchOrderPopular,
+	}
+)
+
+// getSearchQuery checks a saved search and turns it into the query pixiv understands
+func getSearchQuery(s config.Search) (q api.SearchQuery, err error) {
+	if s.Word == "" {
+		return q, fmt.Errorf("saved search \"%s\" has no Word", s.Name)
+	}
+	q = api.SearchQuery{Word: s.Word, From: s.From, To: s.To, MinBookmarks: s.MinBookmarks}
+	var ok bool
+	if q.Type, ok = searchTypes[s.Type]; !ok {
+		return q, fmt.Errorf("Type of saved search \"%s\" is \"%s\", it should be all, illust, manga or ugoira", s.Name, s.Type)
+	}
+	if q.Match, ok = searchMatches[s.Match]; !ok {
+		return q, fmt.Errorf("Match of saved search \"%s\" is \"%s\", it should be tag, partial or text", s.Name, s.Match)
+	}
+	if q.Mode, ok = searchModes[s.Mode]; !ok {
+		return q, fmt.Errorf("Mode of saved search \"%s\" is \"%s\", it should be all, safe or r18", s.Name, s.Mode)
+	}
+	if q.Order, ok = searchOrders[s.Order]; !ok {
+		return q, fmt.Errorf("Order of saved search \"%s\" is \"%s\", it should be newest, oldest or popular", s.Name, s.Order)
+	}
+	for _, date := range []string{s.From, s.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(searchDateLayout, date); err != nil {
+			return q, fmt.Errorf("date \"%s\" of saved search \"%s\" should be YYYY-MM-DD", date, s.Name)
+		}
+	}
+	return q, nil
+}
+
+// getSearches are the saved searches of the given names, or all of them when no name is given
+func getSearches(names []string) (searches []config.Search, err error) {
+	if len(config.Config.Searches) <= 0 {
+		return searches, fmt.Errorf("Searches is empty")
+	}
+	if len(names) <= 0 {
+		return config.Config.Searches, nil
+	}
+	for _, name := range names {
+		found := false
+		for _, s := range config.Config.Searches {
+			if s.Name == name {
+				searches = append(searches, s)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return searches, fmt.Errorf("no saved search is named \"%s\"", name)
+		}
+	}
+	return searches, nil
+}
+
+// DownloadSearches downloads the results of the saved searches of the given names, or of all of them.
+// Errors after some items were processed are returned as common.PartialError.
+func DownloadSearches(ctx context.Context, names []string) (err error) {
+	searches, err := getSearches(names)
+	if err != nil {
+		return err
+	}
+	for _, s := range searches {
+		_, err = getSearchQuery(s)
+		if err != nil {
+			return err
+		}
+	}
+	lists, err := getBookmarkLists()
+	if err != nil {
+		return err
+	}
+	err = loginAndLoadState(ctx)
+	if err != nil {
+		return err
+	}
+	err = iterateSearches(ctx, lists, searches, downloadArtwork)
+	return endRun(ctx, err)
+}
+
+// iterateSearches submits the results of every saved search to the tab pool.
+// Bookmarks carrying a tag of ExcludeBookmarkTags in lists are skipped like in the bookmark sync.
+func iterateSearches(ctx context.Context, lists []string, searches []config.Search, toDo func(context.Context) error) (err error) {
+	excluded, err := listExcludedBookmarks(ctx, lists)
+	if err != nil {
+		return err
+	}
+	pool := newTabPool(ctx, toDo)
+	defer func() {
+		err = common.ConcatenateErrors(err, getResultsError(pool.Wait()))
+	}()
+
+	client := newBrowserApiClient(ctx)
+	submitter := newBookmarkSubmitter(pool, excluded)
+	var errs []error
+	for _, s := range searches {
+		if shutdown.Stopping(ctx) {
+			break
+		}
+		errs = append(errs, iterateSearch(ctx, client, submitter, s))
+	}
+	return common.ConcatenateErrors(errs...)
+}
+
+func iterateSearch(ctx context.Context, client *api.Client, submitter *bookmarkSubmitter, s config.Search) (err error) {
+	q, err := getSearchQuery(s)
+	if err != nil {
+		return err
+	}
+	//pixiv only filters by bookmarks for premium accounts, so they are also checked on the artwork
+	item := artworkItem{MinBookmarks: s.MinBookmarks}
+	maxItems := s.GetMaxItems()
+	listed := 0
+	for page := 1; listed < maxItems; page++ {
+		results, total, err := client.Search(ctx, q, page)
+		if err != nil {
+			return err
+		}
+		var artworkIDs []string
+		for _, result := range results {
+			if listed >= maxItems {
+				break
+			}
+			listed++
+			if result.IsMasked {
+				continue
+			}
+			artworkIDs = append(artworkIDs, string(result.ID))
+		}
+		pages := (total + api.SearchPageSize - 1) / api.SearchPageSize
+		if maxPages := (maxItems + api.SearchPageSize - 1) / api.SearchPageSize; pages > maxPages {
+			pages = maxPages
+		}
+		position := api.PagePosition{Number: page, Pages: pages}
+		stop, err := submitArtworkPage(ctx, submitter, item, fmt.Sprintf("saved search \"%s\"", s.Name), position, artworkIDs)
+		if err != nil {
+			return err
+		}
+		//only the newest first order puts what was downloaded by an earlier run after what is new
+		if stop && q.Order == api.SearchOrderNewest {
+			break
+		}
+		if len(results) <= 0 || page*api.SearchPageSize >= total {
+			break
+		}
+	}
+	logging.FromContext(ctx).Info("listed results of saved search", "search", s.Name, "count", listed)
+	return nil
+}
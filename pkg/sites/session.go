@@ -0,0 +1,178 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package sites
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+)
+
+func getSessionFilePath() string {
+	if config.Config.SessionFile != "" {
+		return config.Config.SessionFile
+	}
+	return config.DefaultSessionFilePath
+}
+
+// saveSession writes all cookies of the browser to the session file
+func saveSession(ctx context.Context) (err error) {
+	var cookies []*network.Cookie
+	err = chromedp.Run(ctx,
+		chromedp.ActionFunc(func(ctx context.Context) (err error) {
+			cookies, err = network.GetAllCookies().Do(ctx)
+			return err
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get cookies from browser: %+v", err)
+	}
+
+	buf, err := json.MarshalIndent(cookies, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cookies: %+v", err)
+	}
+	path := getSessionFilePath()
+	err = ioutil.WriteFile(path, buf, config.SessionFilePermission)
+	if err != nil {
+		return fmt.Errorf("failed to write session to \"%s\": %+v", path, err)
+	}
+	logging.FromContext(ctx).Info("saved session", logging.KeyPath, path)
+	return nil
+}
+
+// restoreSession loads cookies from the session file into the browser.
+// restored is false when there is no session file yet.
+func restoreSession(ctx context.Context) (restored bool, err error) {
+	path := getSessionFilePath()
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read session file \"%s\": %+v", path, err)
+	}
+
+	var cookies []*network.Cookie
+	err = json.Unmarshal(buf, &cookies)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal session file \"%s\": %+v", path, err)
+	}
+
+	var params []*network.CookieParam
+	for _, cookie := range cookies {
+		param := &network.CookieParam{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HTTPOnly: cookie.HTTPOnly,
+			SameSite: cookie.SameSite,
+			Priority: cookie.Priority,
+		}
+		if !cookie.Session {
+			expires := cdp.TimeSinceEpoch(time.Unix(0, int64(cookie.Expires*float64(time.Second))))
+			param.Expires = &expires
+		}
+		params = append(params, param)
+	}
+
+	err = chromedp.Run(ctx,
+		network.SetCookies(params),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to set cookies from session file \"%s\": %+v", path, err)
+	}
+	return true, nil
+}
+
+func removeSession() (err error) {
+	path := getSessionFilePath()
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove session file \"%s\": %+v", path, err)
+	}
+	return nil
+}
+
+// isSessionValid opens pixiv and waits for the top left pixiv image which is only shown to logged in users
+func isSessionValid(ctx context.Context) (valid bool, err error) {
+	err = chromedp.Run(ctx,
+		chromedp.Navigate(config.PixivSiteUrl),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to navigate to \"%s\": %+v", config.PixivSiteUrl, err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, config.SessionCheckTimeout)
+	defer cancel()
+	err = chromedp.Run(waitCtx,
+		chromedp.WaitVisible(config.TopLeftPixivImgSel, chromedp.ByQuery),
+	)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// loginPixivWithSession reuses the saved session and only falls back to loginPixiv when the session is missing or stale
+func loginPixivWithSession(ctx context.Context) (err error) {
+	restored, err := restoreSession(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to restore session", logging.KeyError, err)
+	}
+	if restored {
+		valid, err := isSessionValid(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check restored session: %+v", err)
+		}
+		if valid {
+			logging.FromContext(ctx).Info("reusing saved session")
+			return nil
+		}
+		logging.FromContext(ctx).Info("saved session is stale, logging in again")
+	}
+
+	err = loginPixiv(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = saveSession(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to save session", logging.KeyError, err)
+	}
+	return nil
+}
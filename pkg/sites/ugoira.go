@@ -0,0 +1,89 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package sites
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/download"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/paths"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/ugoira"
+)
+
+// downloadUgoira keeps the original frame zip and the frame timing, and assembles the frames into a gif.
+// The artwork is left for the caller to mark complete.
+func downloadUgoira(ctx context.Context, artworkID string, values paths.Values) (pageCount int, err error) {
+	meta, err := newBrowserApiClient(ctx).UgoiraMeta(ctx, artworkID)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get ugoira meta: %+v", err)
+	}
+	zipUrl := meta.OriginalSrc
+	if zipUrl == "" {
+		zipUrl = meta.Src
+	}
+
+	var frames []ugoira.Frame
+	for _, frame := range meta.Frames {
+		frames = append(frames, ugoira.Frame{File: frame.File, Delay: frame.Delay})
+	}
+
+	prefix, err := getArtworkFilePath(values, config.UgoiraFileSuffix)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get ugoira path of artwork %s: %+v", artworkID, err)
+	}
+	zipPath := prefix + ".zip"
+	_, err = download.Direct.Download(ctx, zipUrl, zipPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download ugoira zip: %+v", err)
+	}
+
+	timing := ugoira.Timing{
+		ArtworkID: artworkID,
+		MimeType:  meta.MimeType,
+		Frames:    frames,
+	}
+	err = ugoira.WriteTiming(prefix+".json", timing)
+	if err != nil {
+		return 0, err
+	}
+
+	gifPath := prefix + ".gif"
+	err = ugoira.WriteGif(zipPath, frames, gifPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to assemble ugoira: %+v", err)
+	}
+	logging.FromContext(ctx).Info("wrote file", logging.KeyPath, gifPath)
+
+	if config.Config.UgoiraFrameFolder {
+		err = ugoira.WriteFrameFolder(zipPath, frames, prefix)
+		if err != nil {
+			return 0, fmt.Errorf("failed to write ugoira frames: %+v", err)
+		}
+	}
+
+	state.Downloads.AddPage(artworkID, 0, gifPath)
+	return 1, nil
+}
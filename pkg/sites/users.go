@@ -0,0 +1,164 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sites
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/api"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/shutdown"
+)
+
+func parseUserArg(user string) (userID string, err error) {
+	if _, err := strconv.Atoi(user); err == nil {
+		return user, nil
+	}
+	userID = common.Get1stGroupMatch(user, config.UserUrlSuffixRe)
+	if userID == "" {
+		return userID, fmt.Errorf("\"%s\" is neither a user url nor a user ID", user)
+	}
+	return userID, nil
+}
+
+// DownloadUserWorks downloads every work of the given users. Errors after some items were processed are returned as common.PartialError.
+func DownloadUserWorks(ctx context.Context, users []string) (err error) {
+	var userIDs []string
+	for _, user := range users {
+		userID, err := parseUserArg(user)
+		if err != nil {
+			return err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	lists, err := getBookmarkLists()
+	if err != nil {
+		return err
+	}
+
+	err = loginAndLoadState(ctx)
+	if err != nil {
+		return err
+	}
+	err = iterateUserWorks(ctx, lists, userIDs, downloadArtwork)
+	return endRun(ctx, err)
+}
+
+// DownloadFollowing downloads every work of every user we follow, publicly or privately.
+// Errors after some items were processed are returned as common.PartialError.
+func DownloadFollowing(ctx context.Context) (err error) {
+	lists, err := getBookmarkLists()
+	if err != nil {
+		return err
+	}
+	err = loginAndLoadState(ctx)
+	if err != nil {
+		return err
+	}
+	err = findUserID(ctx)
+	if err != nil {
+		return endRun(ctx, err)
+	}
+	userIDs, err := getFollowedUserIDs(ctx)
+	if err != nil {
+		return endRun(ctx, err)
+	}
+	logging.FromContext(ctx).Info("listed followed users", "count", len(userIDs))
+	err = iterateUserWorks(ctx, lists, userIDs, downloadArtwork)
+	return endRun(ctx, err)
+}
+
+// getFollowedUserIDs lists the users we follow through the json endpoint, public follows first
+func getFollowedUserIDs(ctx context.Context) (userIDs []string, err error) {
+	client := newBrowserApiClient(ctx)
+	seen := make(map[string]struct{})
+	handle := func(users []api.FollowedUser, _ api.PagePosition) (stop bool, err error) {
+		for _, user := range users {
+			userID := string(user.UserID)
+			if _, ok := seen[userID]; ok {
+				continue
+			}
+			seen[userID] = struct{}{}
+			userIDs = append(userIDs, userID)
+		}
+		return false, nil
+	}
+	for _, rest := range []string{api.RestShow, api.RestHide} {
+		err = client.EnumerateFollowing(ctx, config.Config.UserID, rest, api.DefaultFollowingPageSize, 0, handle)
+		if err != nil {
+			return userIDs, fmt.Errorf("unable to list followed users: %+v", err)
+		}
+	}
+	return userIDs, nil
+}
+
+// iterateUserWorks submits the works of every user to the tab pool, newest first and a page at a time,
+// so that incremental mode moves on to the next user at the first fully downloaded page.
+// Bookmarks carrying a tag of ExcludeBookmarkTags in lists are skipped like in the bookmark sync.
+func iterateUserWorks(ctx context.Context, lists []string, userIDs []string, toDo func(context.Context) error) (err error) {
+	excluded, err := listExcludedBookmarks(ctx, lists)
+	if err != nil {
+		return err
+	}
+	pool := newTabPool(ctx, toDo)
+	defer func() {
+		err = common.ConcatenateErrors(err, getResultsError(pool.Wait()))
+	}()
+
+	client := newBrowserApiClient(ctx)
+	submitter := newBookmarkSubmitter(pool, excluded)
+	var errs []error
+	for _, userID := range userIDs {
+		if shutdown.Stopping(ctx) {
+			break
+		}
+		artworkIDs, err := client.UserWorks(ctx, userID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logging.FromContext(ctx).Info("listed works of user", logging.KeyUser, userID, "count", len(artworkIDs))
+		listing := fmt.Sprintf("works of user %s", userID)
+		pages := (len(artworkIDs) + api.DefaultBookmarkPageSize - 1) / api.DefaultBookmarkPageSize
+		for start := 0; start < len(artworkIDs); start += api.DefaultBookmarkPageSize {
+			end := start + api.DefaultBookmarkPageSize
+			if end > len(artworkIDs) {
+				end = len(artworkIDs)
+			}
+			position := api.PagePosition{Number: start/api.DefaultBookmarkPageSize + 1, Pages: pages}
+			stop, err := submitArtworkPage(ctx, submitter, artworkItem{}, listing, position, artworkIDs[start:end])
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			if stop {
+				break
+			}
+		}
+	}
+	return common.ConcatenateErrors(errs...)
+}
@@ -0,0 +1,62 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package sites
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/config"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/state"
+)
+
+// VerifyFiles checks every file in the manifest against its recorded size and checksum
+func VerifyFiles(ctx context.Context) (err error) {
+	err = state.Manifest.Load(config.ManifestPath(), config.Config.OutputRoot)
+	if err != nil {
+		return err
+	}
+	records := state.Manifest.Records()
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Path < records[j].Path
+	})
+	logger := logging.FromContext(ctx)
+	bad := 0
+	for _, record := range records {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		problem := state.Manifest.Check(record)
+		if problem != "" {
+			bad++
+			logger.Warn("file does not match the manifest", logging.KeyPath, record.Path, "problem", problem)
+		}
+	}
+	logger.Info("verified files", "count", len(records), "bad", bad)
+	if bad > 0 {
+		return common.Partial(fmt.Errorf("%d of %d files do not match the manifest", bad, len(records)))
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	Downloads = new(downloadStore)
+)
+
+const (
+	stateFilePermission = 0644
+)
+
+// Artwork is the download record of a single artwork
+type Artwork struct {
+	ID           string         `json:"id"`
+	Pages        map[int]string `json:"pages"` //page index -> saved file path
+	PageCount    int            `json:"pageCount"`
+	Complete     bool           `json:"complete"`
+	BookmarkList string         `json:"bookmarkList,omitempty"` //public or private, when it was found through the bookmarks
+	FewBookmarks bool           `json:"fewBookmarks,omitempty"` //skipped for having fewer bookmarks than asked for
+	Bookmarks    int            `json:"bookmarks,omitempty"`    //the bookmark count when it was skipped
+	UpdatedAt    time.Time      `json:"updatedAt"`
+}
+
+type downloadStore struct {
+	lock     sync.Mutex
+	path     string
+	artworks map[string]*Artwork
+}
+
+// Load reads the store from path. A missing file gives an empty store.
+func (s *downloadStore) Load(path string) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.path = path
+	s.artworks = make(map[string]*Artwork)
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read download state at \"%s\": %+v", path, err)
+	}
+	err = json.Unmarshal(buf, &s.artworks)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal download state at \"%s\": %+v", path, err)
+	}
+	return nil
+}
+
+// Save writes the store back to the path it was loaded from
+func (s *downloadStore) Save() (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.save()
+}
+
+func (s *downloadStore) save() (err error) {
+	if s.path == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(s.artworks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal download state: %+v", err)
+	}
+	return writeStateFile(s.path, buf, "download state")
+}
+
+// writeStateFile writes buf to a temp file first so that a crash never leaves a truncated state file at path.
+// what names the file in errors.
+func writeStateFile(path string, buf []byte, what string) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file for %s: %+v", what, err)
+	}
+	_, err = tmp.Write(buf)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), stateFilePermission)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("unable to write %s: %+v", what, err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("unable to move %s to \"%s\": %+v", what, path, err)
+	}
+	return nil
+}
+
+func (s *downloadStore) get(id string) *Artwork {
+	if s.artworks == nil {
+		s.artworks = make(map[string]*Artwork)
+	}
+	artwork, ok := s.artworks[id]
+	if !ok {
+		artwork = &Artwork{
+			ID:    id,
+			Pages: make(map[int]string),
+		}
+		s.artworks[id] = artwork
+	}
+	return artwork
+}
+
+// IsComplete tells if every page of the artwork was downloaded
+func (s *downloadStore) IsComplete(id string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	artwork, ok := s.artworks[id]
+	return ok && artwork.Complete
+}
+
+// AddPage records a saved page of an artwork
+func (s *downloadStore) AddPage(id string, page int, filePath string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	artwork := s.get(id)
+	artwork.Pages[page] = filePath
+	artwork.UpdatedAt = time.Now()
+}
+
+// SetBookmarkList records which bookmark list the artwork came from
+func (s *downloadStore) SetBookmarkList(id string, list string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	artwork := s.get(id)
+	artwork.BookmarkList = list
+}
+
+// MarkFewBookmarks records that the artwork was skipped with only count bookmarks and persists the store
+func (s *downloadStore) MarkFewBookmarks(id string, count int) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	artwork := s.get(id)
+	artwork.FewBookmarks = true
+	artwork.Bookmarks = count
+	artwork.UpdatedAt = time.Now()
+	return s.save()
+}
+
+// HasFewBookmarks tells if the artwork was skipped earlier with fewer than min bookmarks
+func (s *downloadStore) HasFewBookmarks(id string, min int) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	artwork, ok := s.artworks[id]
+	return ok && artwork.FewBookmarks && artwork.Bookmarks < min
+}
+
+// MarkComplete marks an artwork as fully downloaded and persists the store
+func (s *downloadStore) MarkComplete(id string, pageCount int) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	artwork := s.get(id)
+	artwork.PageCount = pageCount
+	artwork.Complete = len(artwork.Pages) >= pageCount
+	artwork.UpdatedAt = time.Now()
+	return s.save()
+}
@@ -0,0 +1,145 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	Failures = new(failureQueue)
+)
+
+// Failure is an item that failed and waits to be retried
+type Failure struct {
+	ID           string    `json:"id"` //the artwork ID, or "novel/" and the novel ID
+	Url          string    `json:"url"`
+	Stage        string    `json:"stage"` //what was being done when it failed
+	Error        string    `json:"error"`
+	BookmarkList string    `json:"bookmarkList,omitempty"`
+	BookmarkTag  string    `json:"bookmarkTag,omitempty"`
+	MinBookmarks int       `json:"minBookmarks,omitempty"`
+	Attempts     int       `json:"attempts"`
+	FirstFailed  time.Time `json:"firstFailed"`
+	LastFailed   time.Time `json:"lastFailed"`
+}
+
+// failureQueue keeps the failed items across runs until they succeed
+type failureQueue struct {
+	lock     sync.Mutex
+	path     string
+	failures map[string]*Failure
+}
+
+// Load reads the queue from path. A missing file gives an empty queue.
+func (q *failureQueue) Load(path string) (err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.path = path
+	q.failures = make(map[string]*Failure)
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read failure queue at \"%s\": %+v", path, err)
+	}
+	var failures []*Failure
+	err = json.Unmarshal(buf, &failures)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal failure queue at \"%s\": %+v", path, err)
+	}
+	for _, failure := range failures {
+		q.failures[failure.ID] = failure
+	}
+	return nil
+}
+
+func (q *failureQueue) save() (err error) {
+	if q.path == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(q.list(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal failure queue: %+v", err)
+	}
+	return writeStateFile(q.path, buf, "failure queue")
+}
+
+func (q *failureQueue) list() (failures []Failure) {
+	failures = make([]Failure, 0, len(q.failures))
+	for _, failure := range q.failures {
+		failures = append(failures, *failure)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if !failures[i].FirstFailed.Equal(failures[j].FirstFailed) {
+			return failures[i].FirstFailed.Before(failures[j].FirstFailed)
+		}
+		return failures[i].ID < failures[j].ID
+	})
+	return failures
+}
+
+// Add queues failure, or updates the entry of an item that failed before, and persists the queue
+func (q *failureQueue) Add(failure Failure) (err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.failures == nil {
+		q.failures = make(map[string]*Failure)
+	}
+	now := time.Now()
+	failure.Attempts = 1
+	failure.FirstFailed = now
+	failure.LastFailed = now
+	if queued, ok := q.failures[failure.ID]; ok {
+		failure.Attempts = queued.Attempts + 1
+		failure.FirstFailed = queued.FirstFailed
+	}
+	q.failures[failure.ID] = &failure
+	return q.save()
+}
+
+// Remove takes the item out of the queue and persists the queue. It does nothing when the item is not queued.
+func (q *failureQueue) Remove(id string) (err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if _, ok := q.failures[id]; !ok {
+		return nil
+	}
+	delete(q.failures, id)
+	return q.save()
+}
+
+// List is every queued failure, the oldest first
+func (q *failureQueue) List() (failures []Failure) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.list()
+}
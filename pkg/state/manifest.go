@@ -0,0 +1,165 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package state
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/logging"
+)
+
+var (
+	Manifest = new(manifest)
+)
+
+// FileRecord is the size and checksum of a saved file at the time it was written
+type FileRecord struct {
+	Path      string    `json:"path"` //relative to the root of the manifest
+	Size      int64     `json:"size"`
+	Sha256    string    `json:"sha256"`
+	WrittenAt time.Time `json:"writtenAt"`
+}
+
+// manifest keeps a FileRecord per saved file. It is a json lines file that is only appended to,
+// the last record of a path wins.
+type manifest struct {
+	lock    sync.Mutex
+	path    string
+	root    string
+	records map[string]FileRecord
+}
+
+// Load reads the manifest at path. Paths of records are relative to root.
+func (m *manifest) Load(path string, root string) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.path = path
+	m.root = root
+	m.records = make(map[string]FileRecord)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open manifest at \"%s\": %+v", path, err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		var record FileRecord
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			//a crash can leave a torn last line
+			logging.Warn("skipping line of manifest", "line", lineNum, logging.KeyPath, path, logging.KeyError, err)
+			continue
+		}
+		m.records[record.Path] = record
+	}
+	return scanner.Err()
+}
+
+// Add records a written file
+func (m *manifest) Add(filePath string, size int64, sha256sum string) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.path == "" {
+		return nil
+	}
+	rel, err := filepath.Rel(m.root, filePath)
+	if err != nil {
+		rel = filePath
+	}
+	record := FileRecord{
+		Path:      filepath.ToSlash(rel),
+		Size:      size,
+		Sha256:    sha256sum,
+		WrittenAt: time.Now(),
+	}
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("unable to marshal manifest record: %+v", err)
+	}
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, stateFilePermission)
+	if err != nil {
+		return fmt.Errorf("unable to open manifest at \"%s\": %+v", m.path, err)
+	}
+	_, err = f.Write(append(buf, '\n'))
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to append to manifest at \"%s\": %+v", m.path, err)
+	}
+	if m.records == nil {
+		m.records = make(map[string]FileRecord)
+	}
+	m.records[record.Path] = record
+	return nil
+}
+
+// Check tells why a recorded file no longer matches its record. problem is empty when it matches.
+func (m *manifest) Check(record FileRecord) (problem string) {
+	m.lock.Lock()
+	root := m.root
+	m.lock.Unlock()
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(record.Path)))
+	if os.IsNotExist(err) {
+		return "missing"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err.Error()
+	}
+	if size != record.Size {
+		return fmt.Sprintf("size is %d, was %d", size, record.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != record.Sha256 {
+		return fmt.Sprintf("sha256 is %s, was %s", sum, record.Sha256)
+	}
+	return ""
+}
+
+// Records returns all records
+func (m *manifest) Records() (records []FileRecord) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, record := range m.records {
+		records = append(records, record)
+	}
+	return records
+}
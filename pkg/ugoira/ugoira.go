@@ -0,0 +1,206 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package ugoira
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qkthomas/pixiv_bookmarks_downloader/pkg/common"
+)
+
+const (
+	ffconcatFilename = `frames.ffconcat`
+	dirPermission    = 0755
+)
+
+// Frame is a single frame of an ugoira. Delay is in milliseconds.
+type Frame struct {
+	File  string `json:"file"`
+	Delay int    `json:"delay"`
+}
+
+// Timing is what gets written to the frame-timing json next to the assembled animation
+type Timing struct {
+	ArtworkID string  `json:"artworkId"`
+	MimeType  string  `json:"mimeType"`
+	Frames    []Frame `json:"frames"`
+}
+
+// WriteTiming writes the frame timing as json to path
+func WriteTiming(path string, timing Timing) (err error) {
+	buf, err := json.MarshalIndent(timing, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal frame timing: %+v", err)
+	}
+	err = common.SaveFile(path, buf)
+	if err != nil {
+		return fmt.Errorf("failed to write frame timing to \"%s\": %+v", path, err)
+	}
+	return nil
+}
+
+func readFrames(zipPath string) (files map[string]*zip.File, closeFunc func() error, err error) {
+	closeFunc = func() error { return nil } //panic guard
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return files, closeFunc, fmt.Errorf("unable to open zip \"%s\": %+v", zipPath, err)
+	}
+	files = make(map[string]*zip.File)
+	for _, file := range reader.File {
+		files[file.Name] = file
+	}
+	return files, reader.Close, nil
+}
+
+func decodeFrame(file *zip.File) (img image.Image, err error) {
+	rc, err := file.Open()
+	if err != nil {
+		return img, fmt.Errorf("unable to open frame \"%s\": %+v", file.Name, err)
+	}
+	defer rc.Close()
+	img, _, err = image.Decode(rc)
+	if err != nil {
+		return img, fmt.Errorf("unable to decode frame \"%s\": %+v", file.Name, err)
+	}
+	return img, nil
+}
+
+// WriteGif assembles the frames in the zip into an animated gif at outPath
+func WriteGif(zipPath string, frames []Frame, outPath string) (err error) {
+	files, closeZip, err := readFrames(zipPath)
+	if err != nil {
+		return err
+	}
+	defer closeZip()
+
+	anim := &gif.GIF{}
+	for _, frame := range frames {
+		file, ok := files[frame.File]
+		if !ok {
+			return fmt.Errorf("frame \"%s\" is not in zip \"%s\"", frame.File, zipPath)
+		}
+		img, err := decodeFrame(file)
+		if err != nil {
+			return err
+		}
+		bounds := img.Bounds()
+		paletted := image.NewPaletted(bounds, palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, bounds, img, bounds.Min)
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, gifDelay(frame.Delay))
+	}
+	if len(anim.Image) <= 0 {
+		return fmt.Errorf("no frame to assemble from \"%s\"", zipPath)
+	}
+
+	var out bytes.Buffer
+	err = gif.EncodeAll(&out, anim)
+	if err != nil {
+		return fmt.Errorf("unable to encode gif for \"%s\": %+v", outPath, err)
+	}
+	err = common.SaveFile(outPath, out.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to write gif to \"%s\": %+v", outPath, err)
+	}
+	return nil
+}
+
+// gifDelay turns a delay in milliseconds into the 100ths of a second of a gif, rounded.
+// Viewers play a delay of 0 at their own speed, so it is at least 1.
+func gifDelay(ms int) int {
+	cs := (ms + 5) / 10
+	if cs < 1 {
+		cs = 1
+	}
+	return cs
+}
+
+// WriteFrameFolder extracts the frames into dir along with an ffmpeg concat file,
+// so that the frames can be turned into an APNG or a WebM with e.g.
+// "ffmpeg -f concat -i frames.ffconcat out.webm"
+func WriteFrameFolder(zipPath string, frames []Frame, dir string) (err error) {
+	files, closeZip, err := readFrames(zipPath)
+	if err != nil {
+		return err
+	}
+	defer closeZip()
+
+	err = os.MkdirAll(dir, dirPermission)
+	if err != nil {
+		return fmt.Errorf("unable to create directory \"%s\": %+v", dir, err)
+	}
+
+	var concat strings.Builder
+	concat.WriteString("ffconcat version 1.0\n")
+	for _, frame := range frames {
+		file, ok := files[frame.File]
+		if !ok {
+			return fmt.Errorf("frame \"%s\" is not in zip \"%s\"", frame.File, zipPath)
+		}
+		err = extractFile(file, filepath.Join(dir, filepath.Base(frame.File)))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&concat, "file '%s'\nduration %.3f\n", filepath.Base(frame.File), float64(frame.Delay)/1000)
+	}
+	//the last frame has to be repeated for its duration to be respected
+	if len(frames) > 0 {
+		fmt.Fprintf(&concat, "file '%s'\n", filepath.Base(frames[len(frames)-1].File))
+	}
+
+	concatPath := filepath.Join(dir, ffconcatFilename)
+	err = common.SaveFile(concatPath, []byte(concat.String()))
+	if err != nil {
+		return fmt.Errorf("failed to write \"%s\": %+v", concatPath, err)
+	}
+	return nil
+}
+
+func extractFile(file *zip.File, outPath string) (err error) {
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("unable to open frame \"%s\": %+v", file.Name, err)
+	}
+	defer rc.Close()
+	buf, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("unable to read frame \"%s\": %+v", file.Name, err)
+	}
+	err = common.SaveFile(outPath, buf)
+	if err != nil {
+		return fmt.Errorf("failed to write frame to \"%s\": %+v", outPath, err)
+	}
+	return nil
+}
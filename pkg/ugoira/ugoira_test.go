@@ -0,0 +1,110 @@
+// MIT License
+
+// Copyright (c) [2022] [Lin Chen]
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package ugoira
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFrameZip writes a zip with a png frame for every name, like the ugoira zips of pixiv
+func writeFrameZip(t *testing.T, path string, names []string) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i, name := range names {
+		img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		for p := 0; p < len(img.Pix); p += 4 {
+			img.Pix[p], img.Pix[p+3] = uint8(i*80), 0xff
+		}
+		img.Set(0, 0, color.White)
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Create() error = %+v", err)
+		}
+		if err := png.Encode(fw, img); err != nil {
+			t.Fatalf("png.Encode() error = %+v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close() error = %+v", err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %+v", err)
+	}
+}
+
+func TestWriteGif(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "frames.zip")
+	writeFrameZip(t, zipPath, []string{"000000.png", "000001.png", "000002.png", "000003.png"})
+	frames := []Frame{
+		{File: "000000.png", Delay: 15},
+		{File: "000001.png", Delay: 4},
+		{File: "000002.png", Delay: 1000},
+		{File: "000003.png", Delay: 0},
+	}
+
+	gifPath := filepath.Join(dir, "out.gif")
+	err := WriteGif(zipPath, frames, gifPath)
+	if err != nil {
+		t.Fatalf("WriteGif() error = %+v", err)
+	}
+	f, err := os.Open(gifPath)
+	if err != nil {
+		t.Fatalf("Open() error = %+v", err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatalf("gif.DecodeAll() error = %+v", err)
+	}
+	if len(anim.Image) != len(frames) {
+		t.Errorf("gif has %d frames, want %d", len(anim.Image), len(frames))
+	}
+	if want := []int{2, 1, 100, 1}; !reflect.DeepEqual(anim.Delay, want) {
+		t.Errorf("gif delays = %v, want %v", anim.Delay, want)
+	}
+}
+
+func TestWriteGifMissingFrame(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "frames.zip")
+	writeFrameZip(t, zipPath, []string{"000000.png"})
+
+	gifPath := filepath.Join(dir, "out.gif")
+	err := WriteGif(zipPath, []Frame{{File: "000000.png", Delay: 100}, {File: "000001.png", Delay: 100}}, gifPath)
+	if err == nil {
+		t.Fatalf("WriteGif() error = nil, want an error for the missing frame")
+	}
+	if _, err := os.Stat(gifPath); !os.IsNotExist(err) {
+		t.Errorf("gif written despite the missing frame: %+v", err)
+	}
+}